@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Reference data for validating addresses, one JSON file per country. Support for another country is added by
+// dropping its file into address_data; addresses in countries without a file are only normalised.
+//
+//go:embed address_data/*.json
+var addressDataFiles embed.FS
+
+// countryAddressRules describes the postcode format, states/provinces and phone numbering of one country. Regions
+// maps each state or province to the first two digits of its postcodes; aliases map other spellings to region names.
+type countryAddressRules struct {
+	Code          string   `json:"code"`
+	Names         []string `json:"names"`
+	PostalPattern string   `json:"postal_pattern"`
+	PostalExample string   `json:"postal_example"`
+	CallingCode   string   `json:"calling_code"`
+	TrunkPrefix   string   `json:"trunk_prefix"`
+	// Length of phone numbers after the country code
+	NationalNumberMinLength int                 `json:"national_number_min_length"`
+	NationalNumberMaxLength int                 `json:"national_number_max_length"`
+	RegionField             string              `json:"region_field"`
+	Regions                 map[string][]string `json:"regions"`
+	Aliases                 map[string]string   `json:"aliases"`
+
+	postalRegexp *regexp.Regexp
+	regionByKey  map[string]string
+}
+
+// orderAddress points at the fields of one address on an order so they can be normalised in place
+type orderAddress struct {
+	prefix   string
+	Country  *string
+	Address  *string
+	Postal   *string
+	State    *string
+	City     *string
+	Province *string
+}
+
+var addressRulesByCountry = mustLoadAddressRules()
+
+// mustLoadAddressRules parses the embedded reference data, indexed by every name of each country in lower case
+func mustLoadAddressRules() map[string]*countryAddressRules {
+	files, err := addressDataFiles.ReadDir("address_data")
+	if err != nil {
+		panic(err)
+	}
+
+	rulesByCountry := map[string]*countryAddressRules{}
+	for _, file := range files {
+		data, err := addressDataFiles.ReadFile("address_data/" + file.Name())
+		if err != nil {
+			panic(err)
+		}
+		var rules countryAddressRules
+		if err := json.Unmarshal(data, &rules); err != nil {
+			panic(fmt.Sprintf("address_data/%s: %s", file.Name(), err.Error()))
+		}
+
+		rules.postalRegexp = regexp.MustCompile(rules.PostalPattern)
+		rules.regionByKey = map[string]string{}
+		for region := range rules.Regions {
+			rules.regionByKey[strings.ToLower(region)] = region
+		}
+		for alias, region := range rules.Aliases {
+			rules.regionByKey[strings.ToLower(alias)] = region
+		}
+		for _, name := range rules.Names {
+			rulesByCountry[strings.ToLower(name)] = &rules
+		}
+	}
+	return rulesByCountry
+}
+
+func addressRulesFor(country string) *countryAddressRules {
+	return addressRulesByCountry[strings.ToLower(strings.TrimSpace(country))]
+}
+
+// collapseSpaces trims a value and collapses runs of whitespace into single spaces
+func collapseSpaces(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// checkAddress normalises an address in place and validates it against its country's reference data.
+// Malformed postcodes and unknown states are errors; a postcode outside its state is returned as a warning.
+func checkAddress(a orderAddress, errs *validationErrors) string {
+	*a.Address = collapseSpaces(*a.Address)
+	*a.City = collapseSpaces(*a.City)
+	*a.State = collapseSpaces(*a.State)
+	*a.Province = collapseSpaces(*a.Province)
+	*a.Postal = strings.Join(strings.Fields(*a.Postal), "")
+
+	rules := addressRulesFor(*a.Country)
+	if rules == nil {
+		return ""
+	}
+	countryName := rules.Names[0]
+
+	postalValid := *a.Postal != "" && rules.postalRegexp.MatchString(*a.Postal)
+	if *a.Postal != "" && !postalValid {
+		errs.add(a.prefix+"_postal", fmt.Sprintf("is not a valid %s postcode, e.g. %s", countryName, rules.PostalExample))
+	}
+
+	// States and provinces are used interchangeably, so fall back to the other field when the expected one is empty
+	regionField, region := a.prefix+"_state", a.State
+	if rules.RegionField == "province" {
+		regionField, region = a.prefix+"_province", a.Province
+		if *region == "" && *a.State != "" {
+			regionField, region = a.prefix+"_state", a.State
+		}
+	} else if *region == "" && *a.Province != "" {
+		regionField, region = a.prefix+"_province", a.Province
+	}
+	if *region == "" {
+		errs.add(a.prefix+"_"+rules.RegionField, "is required")
+		return ""
+	}
+	canonical, found := rules.regionByKey[strings.ToLower(*region)]
+	if !found {
+		errs.add(regionField, fmt.Sprintf("is not a known %s of %s", rules.RegionField, countryName))
+		return ""
+	}
+	*region = canonical
+
+	if postalValid {
+		for _, prefix := range rules.Regions[canonical] {
+			if strings.HasPrefix(*a.Postal, prefix) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%s_postal %s is not in %s", a.prefix, *a.Postal, canonical)
+	}
+	return ""
+}
+
+// addressWarning joins an order's address warnings for storage, NULL when there are none
+func addressWarning(warnings []string) sql.NullString {
+	return sql.NullString{String: strings.Join(warnings, "; "), Valid: len(warnings) > 0}
+}
+
+// checkOrderAddresses normalises and validates the consignee and pickup addresses of an order, returning mismatch warnings
+func checkOrderAddresses(o *newOrderFromFrontend, errs *validationErrors) []string {
+	var warnings []string
+	addresses := []orderAddress{
+		{prefix: "consignee", Country: &o.ConsigneeCountry, Address: &o.ConsigneeAddress, Postal: &o.ConsigneePostal, State: &o.ConsigneeState, City: &o.ConsigneeCity, Province: &o.ConsigneeProvince},
+		{prefix: "pickup", Country: &o.PickupCountry, Address: &o.PickupAddress, Postal: &o.PickupPostal, State: &o.PickupState, City: &o.PickupCity, Province: &o.PickupProvince},
+	}
+	for _, address := range addresses {
+		if warning := checkAddress(address, errs); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
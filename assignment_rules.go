@@ -0,0 +1,408 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// assignmentRule assigns new orders matching every one of its set criteria to a partner account or organisation,
+// or with a load balancing strategy to whichever covering partner has capacity. Rules are tried in ascending
+// priority and the first match wins.
+type assignmentRule struct {
+	RuleId           int            `json:"rule_id"`
+	RuleName         string         `json:"rule_name"`
+	Priority         int            `json:"priority"`
+	Active           bool           `json:"active"`
+	ConsigneeCountry sql.NullString `json:"consignee_country"`
+	ConsigneeState   sql.NullString `json:"consignee_state"`
+	PostalPrefix     sql.NullString `json:"postal_prefix"`
+	MinWeight        sql.NullInt64  `json:"min_weight"`
+	MaxWeight        sql.NullInt64  `json:"max_weight"`
+	DueWithinHours   sql.NullInt64  `json:"due_within_hours"`
+	AccountId        sql.NullInt64  `json:"account_id"`
+	OrgId            sql.NullInt64  `json:"org_id"`
+	Strategy         string         `json:"strategy"`
+}
+
+type assignmentRuleFromFrontend struct {
+	RuleName         string  `json:"rule_name"`
+	Priority         int     `json:"priority"`
+	Active           *bool   `json:"active"`
+	ConsigneeCountry *string `json:"consignee_country"`
+	ConsigneeState   *string `json:"consignee_state"`
+	PostalPrefix     *string `json:"postal_prefix"`
+	MinWeight        *int    `json:"min_weight"`
+	MaxWeight        *int    `json:"max_weight"`
+	DueWithinHours   *int    `json:"due_within_hours"`
+	AccountId        *int    `json:"account_id"`
+	OrgId            *int    `json:"org_id"`
+	Strategy         string  `json:"strategy"`
+}
+
+// ruleEvaluation explains why a rule did or did not match an order, or why a matching rule could not assign it
+type ruleEvaluation struct {
+	RuleId   int    `json:"rule_id"`
+	RuleName string `json:"rule_name"`
+	Matched  bool   `json:"matched"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+const selectAssignmentRuleSQL = "SELECT rule_id, rule_name, priority, active, consignee_country, consignee_state, postal_prefix, min_weight, max_weight, due_within_hours, account_id, org_id, strategy FROM assignment_rules"
+
+func scanAssignmentRule(row rowScanner, rule *assignmentRule) error {
+	return row.Scan(&rule.RuleId, &rule.RuleName, &rule.Priority, &rule.Active, &rule.ConsigneeCountry, &rule.ConsigneeState, &rule.PostalPrefix, &rule.MinWeight, &rule.MaxWeight, &rule.DueWithinHours, &rule.AccountId, &rule.OrgId, &rule.Strategy)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadActiveAssignmentRules returns active rules in the order they are tried
+func loadActiveAssignmentRules(q queryer) ([]assignmentRule, error) {
+	rows, err := q.Query(selectAssignmentRuleSQL + " WHERE active = TRUE ORDER BY priority, rule_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []assignmentRule
+	for rows.Next() {
+		var rule assignmentRule
+		if err := scanAssignmentRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// mismatch returns why the rule does not match the order, or "" when it does
+func (r assignmentRule) mismatch(o order, now time.Time) string {
+	if r.ConsigneeCountry.Valid && !strings.EqualFold(strings.TrimSpace(o.ConsigneeCountry), r.ConsigneeCountry.String) {
+		return "consignee_country is not " + r.ConsigneeCountry.String
+	}
+	if r.ConsigneeState.Valid && !strings.EqualFold(strings.TrimSpace(o.ConsigneeState), r.ConsigneeState.String) {
+		return "consignee_state is not " + r.ConsigneeState.String
+	}
+	if r.PostalPrefix.Valid && !strings.HasPrefix(strings.TrimSpace(o.ConsigneePostal), r.PostalPrefix.String) {
+		return "consignee_postal does not start with " + r.PostalPrefix.String
+	}
+	if r.MinWeight.Valid && int64(o.OrderWeight) < r.MinWeight.Int64 {
+		return fmt.Sprintf("order_weight is below %d", r.MinWeight.Int64)
+	}
+	if r.MaxWeight.Valid && int64(o.OrderWeight) > r.MaxWeight.Int64 {
+		return fmt.Sprintf("order_weight is above %d", r.MaxWeight.Int64)
+	}
+	if r.DueWithinHours.Valid {
+		if o.DueDate.IsZero() {
+			return "due_date is missing"
+		}
+		if o.DueDate.After(now.Add(time.Duration(r.DueWithinHours.Int64) * time.Hour)) {
+			return fmt.Sprintf("due_date is not within %d hours", r.DueWithinHours.Int64)
+		}
+	}
+	return ""
+}
+
+// ruleTarget picks the partner a matched rule assigns the order to, with the partner's capacity settings if it has any.
+// ok is false when no partner has capacity left for the order. Capacity rows are locked when lock is set.
+func ruleTarget(q queryer, rule *assignmentRule, o order, lock bool) (accountID int, orgID int, capacity *partnerCapacity, ok bool, err error) {
+	if rule.Strategy == strategyFixed {
+		capacity, err = readPartnerCapacity(q, int(rule.AccountId.Int64), int(rule.OrgId.Int64), lock)
+		if err != nil || (capacity != nil && !capacity.hasRoomFor(o)) {
+			return 0, 0, nil, false, err
+		}
+		return int(rule.AccountId.Int64), int(rule.OrgId.Int64), capacity, true, nil
+	}
+
+	capacity, err = pickPartner(q, rule.Strategy, o, lock)
+	if err != nil || capacity == nil {
+		return 0, 0, nil, false, err
+	}
+	return int(capacity.AccountId.Int64), int(capacity.OrgId.Int64), capacity, true, nil
+}
+
+// assignmentOutcome is the result of trying assignment rules on an order: the rule that assigned it and its target
+// (nil and zero when none did), each rule evaluated, and why matching rules could not assign it
+type assignmentOutcome struct {
+	Rule        *assignmentRule
+	AccountId   int
+	OrgId       int
+	Evaluations []ruleEvaluation
+	Failures    []string
+}
+
+// tryAssignmentRules tries rules in priority order and assigns the order using the first matching rule whose target can
+// take it. A rule whose target has no capacity left or refuses the order (e.g. it does not cover the country) falls
+// through to the next matching rule. A dry run reads capacity without locking it and writes nothing, so tx may be nil.
+func tryAssignmentRules(tx *sql.Tx, rules []assignmentRule, o order, now time.Time, dryRun bool) (assignmentOutcome, error) {
+	var outcome assignmentOutcome
+	var q queryer = db
+	if !dryRun {
+		q = tx
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		reason := rule.mismatch(o, now)
+		outcome.Evaluations = append(outcome.Evaluations, ruleEvaluation{RuleId: rule.RuleId, RuleName: rule.RuleName, Matched: reason == "", Reason: reason})
+		if reason != "" {
+			continue
+		}
+		evaluation := &outcome.Evaluations[len(outcome.Evaluations)-1]
+
+		note := fmt.Sprintf("assignment rule %d: %s", rule.RuleId, rule.RuleName)
+		accountID, orgID, _, ok, err := ruleTarget(q, rule, o, !dryRun)
+		if err != nil {
+			return outcome, err
+		}
+		if !ok {
+			evaluation.Reason = "no partner capacity left"
+			outcome.Failures = append(outcome.Failures, "no partner capacity left for "+note)
+			continue
+		}
+
+		// A dry run checks the target as assignment would; automatic assignments have no actor account
+		if dryRun {
+			_, _, err = resolveAssignmentTarget(q, o, accountID, orgID)
+		} else {
+			_, err = assignOrderTx(tx, user{}, o.OrderId, accountID, orgID, 0, note)
+		}
+		if err != nil {
+			var refused *orderChangeError
+			if errors.As(err, &refused) {
+				evaluation.Reason = "target refused: " + err.Error()
+				outcome.Failures = append(outcome.Failures, note+" refused: "+err.Error())
+				continue
+			}
+			return outcome, err
+		}
+
+		outcome.Rule, outcome.AccountId, outcome.OrgId = rule, accountID, orgID
+		return outcome, nil
+	}
+	return outcome, nil
+}
+
+// autoAssignOrderTx assigns a pending order using the assignment rules, and returns the rule that assigned it, or nil
+// when none did. Orders no matching rule could assign are flagged for manual assignment.
+func autoAssignOrderTx(tx *sql.Tx, orderID int) (*assignmentRule, error) {
+	currentOrder, err := lockOrder(tx, orderID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if currentOrder.Status != statusPending {
+		return nil, nil
+	}
+
+	rules, err := loadActiveAssignmentRules(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome, err := tryAssignmentRules(tx, rules, currentOrder, time.Now(), false)
+	if err != nil {
+		return nil, err
+	}
+	if outcome.Rule != nil || len(outcome.Failures) == 0 {
+		return outcome.Rule, nil
+	}
+	return nil, flagOrderOverflow(tx, currentOrder, strings.Join(outcome.Failures, "; "))
+}
+
+// autoAssignOrder runs the assignment rules for a newly created order in its own transaction
+func autoAssignOrder(orderID int) (*assignmentRule, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rule, err := autoAssignOrderTx(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return rule, tx.Commit()
+}
+
+// validate checks a rule from the frontend has a name, a target and consistent criteria, defaulting to a fixed target
+func (r *assignmentRuleFromFrontend) validate() string {
+	if r.RuleName == "" {
+		return "rule_name is required"
+	}
+	if r.Strategy == "" {
+		r.Strategy = strategyFixed
+	}
+	if !isValidAssignmentStrategy(r.Strategy) {
+		return "strategy must be one of fixed, least_loaded, weighted_round_robin"
+	}
+	if r.Strategy == strategyFixed && r.AccountId == nil && r.OrgId == nil {
+		return "account_id or org_id is required"
+	}
+	if r.MinWeight != nil && r.MaxWeight != nil && *r.MinWeight > *r.MaxWeight {
+		return "min_weight must not be above max_weight"
+	}
+	if r.DueWithinHours != nil && *r.DueWithinHours < 0 {
+		return "due_within_hours must not be negative"
+	}
+	return ""
+}
+
+func (r assignmentRuleFromFrontend) isActive() bool {
+	return r.Active == nil || *r.Active
+}
+
+func getAssignmentRules(c *gin.Context) {
+	var rules []assignmentRule
+
+	rows, err := db.Query(selectAssignmentRuleSQL + " ORDER BY priority, rule_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve assignment rules from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentRule assignmentRule
+		if err := scanAssignmentRule(rows, &currentRule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save assignment rules from DB"})
+			return
+		}
+		rules = append(rules, currentRule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved assignment rules from DB", "rules": rules})
+}
+
+func postAssignmentRule(c *gin.Context) {
+	var reqBody assignmentRuleFromFrontend
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if message := reqBody.validate(); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": message})
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO assignment_rules (rule_name, priority, active, consignee_country, consignee_state, postal_prefix, min_weight, max_weight, due_within_hours, account_id, org_id, strategy) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", reqBody.RuleName, reqBody.Priority, reqBody.isActive(), reqBody.ConsigneeCountry, reqBody.ConsigneeState, reqBody.PostalPrefix, reqBody.MinWeight, reqBody.MaxWeight, reqBody.DueWithinHours, reqBody.AccountId, reqBody.OrgId, reqBody.Strategy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create assignment rule, account or organisation may not exist"})
+		return
+	}
+	ruleID, _ := result.LastInsertId()
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "New Assignment Rule Successfully Created", "ruleId": ruleID})
+}
+
+func updateAssignmentRule(c *gin.Context) {
+	var reqBody assignmentRuleFromFrontend
+
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid rule id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if message := reqBody.validate(); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": message})
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT COUNT(*) > 0 FROM assignment_rules WHERE rule_id=?", ruleID).Scan(&exists); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No assignment rule found"})
+		return
+	}
+
+	if _, err := db.Exec("UPDATE assignment_rules SET rule_name=?, priority=?, active=?, consignee_country=?, consignee_state=?, postal_prefix=?, min_weight=?, max_weight=?, due_within_hours=?, account_id=?, org_id=?, strategy=? WHERE rule_id=?", reqBody.RuleName, reqBody.Priority, reqBody.isActive(), reqBody.ConsigneeCountry, reqBody.ConsigneeState, reqBody.PostalPrefix, reqBody.MinWeight, reqBody.MaxWeight, reqBody.DueWithinHours, reqBody.AccountId, reqBody.OrgId, reqBody.Strategy, ruleID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update assignment rule in database"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Assignment Rule Updated Successfully", "ruleUpdated": ruleID})
+}
+
+func deleteAssignmentRule(c *gin.Context) {
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid rule id"})
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM assignment_rules WHERE rule_id=?", ruleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to delete assignment rule"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No assignment rule found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Assignment Rule Deleted Successfully", "ruleDeleted": ruleID})
+}
+
+// simulateAssignmentRules shows which rule would assign an order, without changing anything.
+// The body is either {"order_id": n} for an existing order or the same fields as POST /new-order.
+func simulateAssignmentRules(c *gin.Context) {
+	var reqBody struct {
+		OrderId int `json:"order_id"`
+		newOrderFromFrontend
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	var currentOrder order
+	if reqBody.OrderId != 0 {
+		if err := scanOrder(db.QueryRow(selectOrderSQL+" WHERE orders.order_id=?", reqBody.OrderId), &currentOrder); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No order found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order from database"})
+			return
+		}
+	} else {
+		currentOrder.OrderWeight = reqBody.OrderWeight
+		currentOrder.ConsigneeCountry = reqBody.ConsigneeCountry
+		currentOrder.ConsigneeState = reqBody.ConsigneeState
+		currentOrder.ConsigneePostal = reqBody.ConsigneePostal
+		// A missing or malformed due date only fails rules with a due date criterion
+		currentOrder.DueDate, _ = parseDueDate(reqBody.DueDate)
+	}
+
+	rules, err := loadActiveAssignmentRules(db)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve assignment rules from DB"})
+		return
+	}
+
+	// Try the rules as auto-assignment would, reading capacity without locking it
+	outcome, err := tryAssignmentRules(nil, rules, currentOrder, time.Now(), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve partner capacity from DB"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully simulated assignment rules", "matchedRule": outcome.Rule, "evaluations": outcome.Evaluations, "accountId": outcome.AccountId, "orgId": outcome.OrgId, "overflow": outcome.Rule == nil && len(outcome.Failures) > 0, "failures": outcome.Failures})
+}
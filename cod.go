@@ -0,0 +1,240 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// codRemittanceFromFrontend is cash on delivery money a partner has handed over for the orders it delivered on a day
+type codRemittanceFromFrontend struct {
+	AccountId      *int    `json:"account_id"`
+	OrgId          *int    `json:"org_id"`
+	RemittanceDate string  `json:"remittance_date"`
+	Currency       string  `json:"currency"`
+	Amount         float64 `json:"amount"`
+	Reference      string  `json:"reference"`
+}
+
+// codReconciliation compares, for one partner, day and currency, the cash on delivery amounts of orders delivered
+// with what the partner recorded collecting and what it remitted. Days are UTC dates.
+type codReconciliation struct {
+	AccountId           sql.NullInt64 `json:"account_id"`
+	OrgId               sql.NullInt64 `json:"org_id"`
+	Date                string        `json:"date"`
+	Currency            string        `json:"currency"`
+	Orders              int           `json:"orders"`
+	Expected            float64       `json:"expected"`
+	Collected           float64       `json:"collected"`
+	Remitted            float64       `json:"remitted"`
+	CollectionShortfall float64       `json:"collection_shortfall"`
+	Outstanding         float64       `json:"outstanding"`
+	DiscrepancyOrders   int           `json:"discrepancy_orders"`
+}
+
+// sameMoneyAmount compares amounts to the cent
+func sameMoneyAmount(a float64, b float64) bool {
+	return math.Round(a*100) == math.Round(b*100)
+}
+
+// validateCOD checks the cash on delivery amount and currency of a new order; an amount of 0 means the order is prepaid
+func (v *validationErrors) validateCOD(o *newOrderFromFrontend) {
+	o.CodCurrency = strings.ToUpper(strings.TrimSpace(o.CodCurrency))
+	if o.CodAmount < 0 || math.IsNaN(o.CodAmount) || math.IsInf(o.CodAmount, 0) {
+		v.add("cod_amount", "must not be negative")
+		return
+	}
+	if o.CodAmount == 0 {
+		if o.CodCurrency != "" {
+			v.add("cod_currency", "must only be set with a cod_amount")
+		}
+		return
+	}
+	if !currencyCodePattern.MatchString(o.CodCurrency) {
+		v.add("cod_currency", "must be a three letter ISO 4217 code, e.g. IDR")
+	}
+}
+
+// codAmount is the stored cash on delivery amount of a new order, NULL for prepaid orders
+func (o newOrderFromFrontend) codAmount() (sql.NullFloat64, sql.NullString) {
+	if o.CodAmount == 0 {
+		return sql.NullFloat64{}, sql.NullString{}
+	}
+	return sql.NullFloat64{Float64: o.CodAmount, Valid: true}, sql.NullString{String: o.CodCurrency, Valid: true}
+}
+
+// recordCODCollectionTx records the cash a partner collected on delivering an order, flagging the order when the
+// amount differs from what was due. It must be called in the same transaction as the change to delivered.
+func recordCODCollectionTx(tx *sql.Tx, actor user, orderID int, collected float64, expectedVersion int) error {
+	currentOrder, err := lockOrder(tx, orderID, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	// Only someone who may deliver the order can record what was collected for it
+	if err := checkOrderTransition(currentOrder.Status, statusDelivered, orderActor(actor, currentOrder)); err != nil {
+		if err == errTransitionForbidden {
+			return newOrderChangeError(http.StatusForbidden, err.Error())
+		}
+		return newOrderChangeError(http.StatusBadRequest, err.Error())
+	}
+	if !currentOrder.CodAmount.Valid {
+		return newOrderChangeError(http.StatusBadRequest, "Order is not cash on delivery")
+	}
+	if currentOrder.CodCollectedAmount.Valid {
+		return newOrderChangeError(http.StatusConflict, "Cash on delivery collection has already been recorded")
+	}
+	if collected < 0 || math.IsNaN(collected) || math.IsInf(collected, 0) {
+		return newOrderChangeError(http.StatusBadRequest, "cod_collected_amount must not be negative")
+	}
+
+	discrepancy := !sameMoneyAmount(collected, currentOrder.CodAmount.Float64)
+	if _, err := tx.Exec("UPDATE orders SET cod_collected_amount=?, cod_collected_at=NOW(), cod_collected_by=?, cod_discrepancy=? WHERE order_id=?", collected, actorID(actor), discrepancy, orderID); err != nil {
+		return err
+	}
+
+	note := ""
+	if discrepancy {
+		note = fmt.Sprintf("collected %.2f %s, expected %.2f", collected, currentOrder.CodCurrency.String, currentOrder.CodAmount.Float64)
+	}
+	return recordOrderEvent(tx, orderEvent{OrderId: orderID, ActorAccountId: actorID(actor), EventType: eventUpdate, NewValue: "cod_collected_amount", Note: note})
+}
+
+// postCODRemittance records cash on delivery money received from a partner
+func postCODRemittance(c *gin.Context) {
+	var reqBody codRemittanceFromFrontend
+	currentUser := c.MustGet("user").(user)
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if (reqBody.AccountId == nil) == (reqBody.OrgId == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Exactly one of account_id or org_id is required"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", reqBody.RemittanceDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "remittance_date must be a date, e.g. 2024-05-01"})
+		return
+	}
+	reqBody.Currency = strings.ToUpper(strings.TrimSpace(reqBody.Currency))
+	if !currencyCodePattern.MatchString(reqBody.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "currency must be a three letter ISO 4217 code, e.g. IDR"})
+		return
+	}
+	if reqBody.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "amount must be positive"})
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO cod_remittances (account_id, org_id, remittance_date, currency, amount, reference, recorded_by) VALUES (?, ?, ?, ?, ?, ?, ?)", reqBody.AccountId, reqBody.OrgId, reqBody.RemittanceDate, reqBody.Currency, reqBody.Amount, reqBody.Reference, actorID(currentUser))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to record remittance, account or organisation may not exist"})
+		return
+	}
+	remittanceID, _ := result.LastInsertId()
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Remittance Recorded Successfully", "remittanceId": remittanceID})
+}
+
+// getCODReconciliation reports expected, collected and remitted cash on delivery per partner per day, optionally
+// between ?from= (inclusive) and ?to= (exclusive) dates. Orders assigned to an organisation count towards the
+// organisation, others towards their account.
+func getCODReconciliation(c *gin.Context) {
+	var collectedConditions, remittedConditions []string
+	var collectedArgs, remittedArgs []interface{}
+	for _, dateRange := range []struct {
+		param    string
+		operator string
+	}{{"from", ">="}, {"to", "<"}} {
+		if value := c.Query(dateRange.param); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": dateRange.param + " must be a date, e.g. 2024-05-01"})
+				return
+			}
+			collectedConditions = append(collectedConditions, "cod_collected_at "+dateRange.operator+" ?")
+			collectedArgs = append(collectedArgs, date)
+			remittedConditions = append(remittedConditions, "remittance_date "+dateRange.operator+" ?")
+			remittedArgs = append(remittedArgs, value)
+		}
+	}
+
+	type reconciliationKey struct {
+		accountID int64
+		orgID     int64
+		date      string
+		currency  string
+	}
+	var report []codReconciliation
+	rowIndex := map[reconciliationKey]int{}
+	rowFor := func(accountID sql.NullInt64, orgID sql.NullInt64, date string, currency string) *codReconciliation {
+		key := reconciliationKey{accountID.Int64, orgID.Int64, date, currency}
+		index, found := rowIndex[key]
+		if !found {
+			index = len(report)
+			rowIndex[key] = index
+			report = append(report, codReconciliation{AccountId: accountID, OrgId: orgID, Date: date, Currency: currency})
+		}
+		return &report[index]
+	}
+
+	where := " WHERE cod_collected_at IS NOT NULL"
+	if len(collectedConditions) > 0 {
+		where += " AND " + strings.Join(collectedConditions, " AND ")
+	}
+	rows, err := db.Query("SELECT IF(org_id IS NULL, account_id, NULL), org_id, DATE_FORMAT(cod_collected_at, '%Y-%m-%d'), cod_currency, COUNT(*), SUM(cod_amount), SUM(cod_collected_amount), SUM(cod_discrepancy) FROM orders"+where+" GROUP BY 1, 2, 3, 4 ORDER BY 3, 2, 1, 4", collectedArgs...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve cash on delivery orders from DB"})
+		return
+	}
+	for rows.Next() {
+		var accountID, orgID sql.NullInt64
+		var date, currency string
+		var orders, discrepancies int
+		var expected, collected float64
+		if err := rows.Scan(&accountID, &orgID, &date, &currency, &orders, &expected, &collected, &discrepancies); err != nil {
+			rows.Close()
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save cash on delivery orders from DB"})
+			return
+		}
+		row := rowFor(accountID, orgID, date, currency)
+		row.Orders, row.Expected, row.Collected, row.DiscrepancyOrders = orders, expected, collected, discrepancies
+	}
+	rows.Close()
+
+	where = ""
+	if len(remittedConditions) > 0 {
+		where = " WHERE " + strings.Join(remittedConditions, " AND ")
+	}
+	rows, err = db.Query("SELECT account_id, org_id, DATE_FORMAT(remittance_date, '%Y-%m-%d'), currency, SUM(amount) FROM cod_remittances"+where+" GROUP BY 1, 2, 3, 4 ORDER BY 3, 2, 1, 4", remittedArgs...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve remittances from DB"})
+		return
+	}
+	for rows.Next() {
+		var accountID, orgID sql.NullInt64
+		var date, currency string
+		var remitted float64
+		if err := rows.Scan(&accountID, &orgID, &date, &currency, &remitted); err != nil {
+			rows.Close()
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save remittances from DB"})
+			return
+		}
+		rowFor(accountID, orgID, date, currency).Remitted = remitted
+	}
+	rows.Close()
+
+	for i := range report {
+		report[i].CollectionShortfall = math.Round((report[i].Expected-report[i].Collected)*100) / 100
+		report[i].Outstanding = math.Round((report[i].Collected-report[i].Remitted)*100) / 100
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully reconciled cash on delivery", "reconciliation": report})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const csrfCookieName = "csrf_token"
+const csrfHeaderName = "X-CSRF-Token"
+
+// Origins allowed to make credentialed requests, loaded from CORS_ALLOWED_ORIGINS
+var allowedOrigins []string
+
+func loadAllowedOrigins() []string {
+	// CORS_ALLOWED_ORIGINS is a comma separated list e.g. "http://localhost:3000,https://geco.example.com"
+	value := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if value == "" {
+		return []string{"http://localhost:3000"}
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+func originAllowed(origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func newRandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// setCSRFCookie issues a fresh double-submit token alongside the Authorisation cookie.
+// The cookie is readable by the frontend (not HttpOnly) so it can be echoed back in the X-CSRF-Token header.
+func setCSRFCookie(c *gin.Context) (string, error) {
+	csrfToken, err := newRandomToken()
+	if err != nil {
+		return "", err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(csrfCookieName, csrfToken, 3600*24, "/", "", false, false)
+	return csrfToken, nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// csrf protects state changing requests made with the Authorisation cookie.
+// Requests without the cookie (e.g. login) are not cookie authenticated and are passed through.
+func csrf(c *gin.Context) {
+	if isSafeMethod(c.Request.Method) {
+		c.Next()
+		return
+	}
+
+	if _, err := c.Cookie("Authorisation"); err != nil {
+		c.Next()
+		return
+	}
+
+	// Verify the request originated from an allowed frontend
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		// Fall back to Referer when browsers omit Origin
+		if referer, err := url.Parse(c.GetHeader("Referer")); err == nil && referer.Host != "" {
+			origin = referer.Scheme + "://" + referer.Host
+		}
+	}
+	if origin != "" && !originAllowed(origin) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": "Request origin not allowed"})
+		return
+	}
+
+	// Double submit check: header token must match the csrf cookie
+	cookieToken, err := c.Cookie(csrfCookieName)
+	headerToken := c.GetHeader(csrfHeaderName)
+	if err != nil || cookieToken == "" || headerToken == "" || subtle.ConstantTimeCompare([]byte(cookieToken), []byte(headerToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": "Invalid or missing CSRF token"})
+		return
+	}
+
+	c.Next()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	// Embedded timezone database so region timezones load on hosts without one
+	_ "time/tzdata"
+)
+
+// Due dates are accepted in RFC 3339 with an offset, stored in UTC and returned in RFC 3339. Each order is also
+// shown in the display timezone of the region covering its consignee country.
+
+// parseDueDate reads an RFC 3339 due date, e.g. 2024-05-01T17:00:00+08:00, as UTC
+func parseDueDate(value string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognised due date %q", value)
+	}
+	return parsed.UTC(), nil
+}
+
+// parseDateFilter reads a date range filter, either RFC 3339 or a plain date taken as midnight UTC
+func parseDateFilter(param string, value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.UTC(), nil
+	}
+	if parsed, err := time.Parse("2006-01-02", value); err == nil {
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a date, e.g. 2024-05-01", param)
+}
+
+// isValidTimezone checks an IANA timezone name such as Asia/Kuala_Lumpur
+func isValidTimezone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return name != "" && err == nil
+}
+
+// countryKey identifies a country however its name is spelled, by its code when there is reference data for it
+func countryKey(country string) string {
+	if rules := addressRulesFor(country); rules != nil {
+		return rules.Code
+	}
+	return strings.ToLower(collapseSpaces(country))
+}
+
+// loadCountryTimezones maps the key of each country covered by a region to the region's display timezone
+func loadCountryTimezones() (map[string]*time.Location, error) {
+	rows, err := db.Query("SELECT region_countries.country, regions.timezone FROM region_countries JOIN regions ON regions.region_id = region_countries.region_id WHERE regions.timezone IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timezones := map[string]*time.Location{}
+	for rows.Next() {
+		var country string
+		var timezone sql.NullString
+		if err := rows.Scan(&country, &timezone); err != nil {
+			return nil, err
+		}
+		location, err := time.LoadLocation(timezone.String)
+		if err != nil {
+			// A bad timezone only loses the local time on responses
+			fmt.Println(err.Error())
+			continue
+		}
+		timezones[countryKey(country)] = location
+	}
+	return timezones, rows.Err()
+}
+
+// localiseOrders adds the due date in the display timezone of each order's consignee country
+func localiseOrders(orders []order) error {
+	timezones, err := loadCountryTimezones()
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		if location, found := timezones[countryKey(orders[i].ConsigneeCountry)]; found {
+			orders[i].DisplayTimezone = location.String()
+			orders[i].DueDateLocal = orders[i].DueDate.In(location).Format(time.RFC3339)
+		}
+	}
+	return nil
+}
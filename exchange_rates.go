@@ -0,0 +1,261 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exchangeRate is the value of one unit of a currency in the base currency
+type exchangeRate struct {
+	Currency     string        `json:"currency"`
+	BaseCurrency string        `json:"base_currency"`
+	Rate         float64       `json:"rate"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	UpdatedBy    sql.NullInt64 `json:"updated_by"`
+}
+
+type exchangeRateFromFrontend struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+// orderTotals sums an order's items in each item currency, and in the base currency at the exchange rates
+// snapshotted for the order. Currencies without a rate are listed and left out of the base total.
+type orderTotals struct {
+	ItemCurrencyTotals map[string]float64 `json:"item_currency_totals"`
+	BaseCurrency       string             `json:"base_currency"`
+	BaseTotal          float64            `json:"base_total"`
+	Rates              map[string]float64 `json:"rates"`
+	MissingRates       []string           `json:"missing_rates"`
+}
+
+// baseCurrency is the currency order totals are reported in, configurable with BASE_CURRENCY (default MYR)
+func baseCurrency() string {
+	if currency := strings.ToUpper(os.Getenv("BASE_CURRENCY")); currencyCodePattern.MatchString(currency) {
+		return currency
+	}
+	return "MYR"
+}
+
+// validate normalises the currency code and checks the rate, returning an error message or ""
+func (r *exchangeRateFromFrontend) validate(base string) string {
+	r.Currency = strings.ToUpper(strings.TrimSpace(r.Currency))
+	if !currencyCodePattern.MatchString(r.Currency) {
+		return "currency must be a three letter ISO 4217 code, e.g. IDR"
+	}
+	if r.Currency == base {
+		return "currency must not be the base currency " + base
+	}
+	if r.Rate <= 0 || math.IsInf(r.Rate, 0) || math.IsNaN(r.Rate) {
+		return "rate of " + r.Currency + " must be a positive number"
+	}
+	return ""
+}
+
+// saveExchangeRates replaces the current rates of the given currencies against the base currency
+func saveExchangeRates(exec execer, rates []exchangeRateFromFrontend, base string, updatedBy sql.NullInt64) error {
+	for _, rate := range rates {
+		if _, err := exec.Exec("INSERT INTO exchange_rates (currency, base_currency, rate, updated_by) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE rate=VALUES(rate), updated_by=VALUES(updated_by), updated_at=NOW()", rate.Currency, base, rate.Rate, updatedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadExchangeRates reads the current rate of every currency against the base currency, including the base itself
+func loadExchangeRates(q queryer) (map[string]float64, error) {
+	base := baseCurrency()
+	rates := map[string]float64{base: 1}
+	rows, err := q.Query("SELECT currency, rate FROM exchange_rates WHERE base_currency=?", base)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency string
+		var rate float64
+		if err := rows.Scan(&currency, &rate); err != nil {
+			return nil, err
+		}
+		rates[currency] = rate
+	}
+	return rates, rows.Err()
+}
+
+// snapshotExchangeRates stores the current rates with a new order, so its base currency total does not change when
+// rates are updated later
+func snapshotExchangeRates(exec execer, orderID int64) error {
+	_, err := exec.Exec("INSERT IGNORE INTO order_exchange_rates (order_id, currency, base_currency, rate) SELECT ?, currency, base_currency, rate FROM exchange_rates WHERE base_currency=?", orderID, baseCurrency())
+	return err
+}
+
+// orderExchangeRate returns the rate snapshotted for an order, with found false when the order has no rate for the
+// currency, e.g. because the rate was only added after the order was created
+func orderExchangeRate(orderID int, currency string, base string) (float64, bool, error) {
+	var rate float64
+	err := db.QueryRow("SELECT rate FROM order_exchange_rates WHERE order_id=? AND currency=? AND base_currency=?", orderID, currency, base).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return rate, err == nil, err
+}
+
+// calculateOrderTotals totals an order's items in their own currencies and the base currency
+func calculateOrderTotals(orderID int, items []item) (orderTotals, error) {
+	base := baseCurrency()
+	totals := orderTotals{ItemCurrencyTotals: map[string]float64{}, BaseCurrency: base, Rates: map[string]float64{}, MissingRates: []string{}}
+
+	var currencies []string
+	for _, currentItem := range items {
+		price, err := strconv.ParseFloat(currentItem.ItemPriceValue, 64)
+		if err != nil {
+			return totals, err
+		}
+		currency := strings.ToUpper(currentItem.ItemPriceCurrency)
+		if _, seen := totals.ItemCurrencyTotals[currency]; !seen {
+			currencies = append(currencies, currency)
+		}
+		totals.ItemCurrencyTotals[currency] += price * float64(currentItem.ItemQuantity)
+	}
+
+	for _, currency := range currencies {
+		totals.ItemCurrencyTotals[currency] = math.Round(totals.ItemCurrencyTotals[currency]*100) / 100
+		rate, found := 1.0, true
+		if currency != base {
+			var err error
+			rate, found, err = orderExchangeRate(orderID, currency, base)
+			if err != nil {
+				return totals, err
+			}
+		}
+		if !found {
+			totals.MissingRates = append(totals.MissingRates, currency)
+			continue
+		}
+		totals.Rates[currency] = rate
+		totals.BaseTotal += totals.ItemCurrencyTotals[currency] * rate
+	}
+	totals.BaseTotal = math.Round(totals.BaseTotal*100) / 100
+	return totals, nil
+}
+
+func getExchangeRates(c *gin.Context) {
+	var rates []exchangeRate
+
+	rows, err := db.Query("SELECT currency, base_currency, rate, updated_at, updated_by FROM exchange_rates WHERE base_currency=? ORDER BY currency", baseCurrency())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve exchange rates from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rate exchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.BaseCurrency, &rate.Rate, &rate.UpdatedAt, &rate.UpdatedBy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save exchange rates from DB"})
+			return
+		}
+		rates = append(rates, rate)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved exchange rates from DB", "baseCurrency": baseCurrency(), "rates": rates})
+}
+
+// putExchangeRates sets the current rates of one or more currencies against the base currency
+func putExchangeRates(c *gin.Context) {
+	var reqBody []exchangeRateFromFrontend
+	currentUser := c.MustGet("user").(user)
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || len(reqBody) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	base := baseCurrency()
+	for i := range reqBody {
+		if message := reqBody[i].validate(base); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": message})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save exchange rates in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := saveExchangeRates(tx, reqBody, base, actorID(currentUser)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save exchange rates in database"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save exchange rates in database"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Exchange Rates Saved Successfully", "ratesSaved": len(reqBody)})
+}
+
+// importExchangeRates loads rates against the base currency from a CSV file of currency,rate lines. A header line
+// is skipped. Nothing is saved unless every line is valid.
+func importExchangeRates(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	base := baseCurrency()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var rates []exchangeRateFromFrontend
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rate, parseErr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if parseErr != nil && line == 1 {
+			continue
+		}
+		if parseErr != nil {
+			return fmt.Errorf("line %d: rate %q is not a number", line, record[1])
+		}
+		current := exchangeRateFromFrontend{Currency: record[0], Rate: rate}
+		if message := current.validate(base); message != "" {
+			return fmt.Errorf("line %d: %s", line, message)
+		}
+		rates = append(rates, current)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := saveExchangeRates(tx, rates, base, sql.NullInt64{}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d exchange rates against %s\n", len(rates), base)
+	return nil
+}
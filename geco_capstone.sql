@@ -1,11 +1,120 @@
 CREATE DATABASE capstonedb
 
+CREATE TABLE regions (
+    region_id INT NOT NULL AUTO_INCREMENT,
+    region_code varchar(10) NOT NULL,
+    region_name varchar(255) NOT NULL,
+    timezone varchar(64),
+    PRIMARY KEY (region_id),
+    UNIQUE KEY uq_region_code (region_code)
+);
+
+CREATE TABLE region_countries (
+    region_id INT NOT NULL,
+    country varchar(255) NOT NULL,
+    PRIMARY KEY (region_id, country),
+    FOREIGN KEY (region_id)
+        REFERENCES regions(region_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE roles (
+    role_id INT NOT NULL AUTO_INCREMENT,
+    role_name varchar(64) NOT NULL,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    region_id INT,
+    description varchar(255) NOT NULL DEFAULT '',
+    volumetric_divisor INT,
+    PRIMARY KEY (role_id),
+    UNIQUE KEY uq_role_name (role_name),
+    FOREIGN KEY (region_id)
+        REFERENCES regions(region_id)
+);
+
+INSERT INTO regions (region_code, region_name, timezone) VALUES ('MY', 'Malaysia', 'Asia/Kuala_Lumpur'), ('ID', 'Indonesia', 'Asia/Jakarta');
+INSERT INTO region_countries (region_id, country) VALUES (1, 'Malaysia'), (1, 'MY'), (2, 'Indonesia'), (2, 'ID');
+INSERT INTO roles (role_name, is_admin, region_id, description) VALUES
+    ('admin', TRUE, NULL, 'GECO administrator'),
+    ('partner_malaysia', FALSE, 1, 'Delivery partner for Malaysia'),
+    ('partner_indonesia', FALSE, 2, 'Delivery partner for Indonesia');
+
+-- Delivery prices of a partner role; weights and lengths in the units set by ORDER_UNITS
+CREATE TABLE rate_cards (
+    rate_card_id INT NOT NULL AUTO_INCREMENT,
+    role_id INT NOT NULL,
+    currency char(3) NOT NULL,
+    oversize_length INT NOT NULL DEFAULT 0,
+    oversize_weight INT NOT NULL DEFAULT 0,
+    oversize_surcharge decimal(10,2) NOT NULL DEFAULT 0,
+    remote_surcharge decimal(10,2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (rate_card_id),
+    UNIQUE KEY uq_rate_cards_role (role_id),
+    FOREIGN KEY (role_id)
+        REFERENCES roles(role_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE rate_card_zones (
+    zone_id INT NOT NULL AUTO_INCREMENT,
+    rate_card_id INT NOT NULL,
+    zone_name varchar(64) NOT NULL,
+    origin_country varchar(255),
+    consignee_country varchar(255) NOT NULL,
+    consignee_state varchar(255),
+    PRIMARY KEY (zone_id),
+    FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE rate_card_bands (
+    band_id INT NOT NULL AUTO_INCREMENT,
+    rate_card_id INT NOT NULL,
+    zone_name varchar(64) NOT NULL,
+    max_weight decimal(10,2) NOT NULL,
+    price decimal(10,2) NOT NULL,
+    PRIMARY KEY (band_id),
+    FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE rate_card_remote_postcodes (
+    rate_card_id INT NOT NULL,
+    postal_prefix varchar(10) NOT NULL,
+    PRIMARY KEY (rate_card_id, postal_prefix),
+    FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE organisations (
+    org_id INT NOT NULL AUTO_INCREMENT,
+    org_name varchar(255) NOT NULL,
+    account_type varchar(64) NOT NULL,
+    PRIMARY KEY (org_id),
+    CONSTRAINT fk_organisation_role
+        FOREIGN KEY (account_type)
+        REFERENCES roles(role_name)
+        ON UPDATE CASCADE
+);
+
 CREATE TABLE accounts (
     account_id INT NOT NULL AUTO_INCREMENT,
     email varchar(255) NOT NULL,
     password text NOT NULL,
-    account_type ENUM ('admin','partner_malaysia','partner_indonesia'),
+    account_type varchar(64),
+    email_verified_at TIMESTAMP NULL,
+    org_id INT,
+    org_role ENUM ('org_admin','dispatcher','driver'),
     PRIMARY KEY (account_id),
+    CONSTRAINT fk_account_role
+        FOREIGN KEY (account_type)
+        REFERENCES roles(role_name)
+        ON UPDATE CASCADE,
+    CONSTRAINT fk_account_organisation
+        FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
 );
 
 CREATE TABLE accounts_details (
@@ -46,11 +155,57 @@ CREATE TABLE orders (
     pickup_city text NOT NULL,
     pickup_province text NOT NULL,
     due_date TIMESTAMP NOT NULL,
-    completed INT NOT NULL,
+    status ENUM ('pending','assigned','accepted','picked_up','in_transit','out_for_delivery','delivered','failed_attempt','returned','cancelled') NOT NULL DEFAULT 'pending',
+    org_id INT,
+    cancel_reason varchar(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version INT NOT NULL DEFAULT 1,
+    needs_manual_assignment BOOLEAN NOT NULL DEFAULT FALSE,
+    assigned_at TIMESTAMP NULL,
+    address_warning varchar(255),
+    consignee_number_e164 varchar(16),
+    pickup_contact_number_e164 varchar(16),
+    sla_status ENUM ('on_track','at_risk','breached'),
+    fingerprint char(64),
+    sales_order_id INT,
+    volumetric_weight decimal(10,2) NOT NULL DEFAULT 0,
+    chargeable_weight decimal(10,2) NOT NULL DEFAULT 0,
+    shipping_cost decimal(10,2),
+    shipping_currency char(3),
+    rate_card_id INT,
+    cod_amount decimal(12,2),
+    cod_currency char(3),
+    cod_collected_amount decimal(12,2),
+    cod_collected_at TIMESTAMP NULL,
+    cod_collected_by INT,
+    cod_discrepancy BOOLEAN NOT NULL DEFAULT FALSE,
     PRIMARY KEY (order_id),
+    KEY idx_orders_status_due_date (status, due_date),
+    KEY idx_orders_due_date (due_date),
+    KEY idx_orders_created_at (created_at),
+    KEY idx_orders_consignee_country (consignee_country),
+    KEY idx_orders_pickup_country (pickup_country),
+    KEY idx_orders_status_assigned_at (status, assigned_at),
+    KEY idx_orders_sla_status (sla_status),
+    KEY idx_orders_fingerprint (fingerprint),
+    UNIQUE KEY uq_orders_sales_order_id (sales_order_id),
+    KEY idx_orders_chargeable_weight (chargeable_weight),
+    KEY idx_orders_cod_collected_at (cod_collected_at),
+    FULLTEXT KEY ft_orders_search (consignee_name, consignee_number, consignee_email, consignee_address, consignee_postal, pickup_contact_name, pickup_contact_number, pickup_address, pickup_postal),
     CONSTRAINT fk_account
         FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id),
+    CONSTRAINT fk_order_organisation
+        FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id),
+    CONSTRAINT fk_order_rate_card
+        FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE SET NULL,
+    CONSTRAINT fk_order_cod_collected_by
+        FOREIGN KEY (cod_collected_by)
         REFERENCES accounts(account_id)
+        ON DELETE SET NULL
 );
 
 CREATE TABLE items (
@@ -71,4 +226,191 @@ CREATE TABLE order_items (
     item_id int,
     FOREIGN KEY (order_id) REFERENCES orders(order_id),
     FOREIGN KEY (item_id) REFERENCES items(item_id)
-);
\ No newline at end of file
+);
+
+CREATE TABLE invitations (
+    invite_id INT NOT NULL AUTO_INCREMENT,
+    email varchar(255) NOT NULL,
+    account_type varchar(64) NOT NULL,
+    token_hash char(64) NOT NULL,
+    created_by INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    PRIMARY KEY (invite_id),
+    UNIQUE KEY uq_invitation_token (token_hash),
+    CONSTRAINT fk_invitation_admin
+        FOREIGN KEY (created_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL,
+    CONSTRAINT fk_invitation_role
+        FOREIGN KEY (account_type)
+        REFERENCES roles(role_name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT
+);
+
+
+CREATE TABLE order_events (
+    event_id INT NOT NULL AUTO_INCREMENT,
+    order_id INT NOT NULL,
+    actor_account_id INT,
+    event_type ENUM ('status','assignment','update','sla') NOT NULL,
+    old_value text NOT NULL,
+    new_value text NOT NULL,
+    note text NOT NULL,
+    location varchar(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id),
+    KEY idx_order_events_order (order_id, created_at),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (actor_account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
+
+
+CREATE TABLE assignment_rules (
+    rule_id INT NOT NULL AUTO_INCREMENT,
+    rule_name varchar(255) NOT NULL,
+    priority INT NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    consignee_country varchar(255),
+    consignee_state varchar(255),
+    postal_prefix varchar(10),
+    min_weight INT,
+    max_weight INT,
+    due_within_hours INT,
+    account_id INT,
+    org_id INT,
+    strategy ENUM ('fixed','least_loaded','weighted_round_robin') NOT NULL DEFAULT 'fixed',
+    PRIMARY KEY (rule_id),
+    KEY idx_assignment_rules_priority (active, priority),
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE CASCADE
+);
+
+
+CREATE TABLE partner_capacity (
+    capacity_id INT NOT NULL AUTO_INCREMENT,
+    account_id INT,
+    org_id INT,
+    daily_parcels INT,
+    daily_weight INT,
+    round_robin_weight INT NOT NULL DEFAULT 1,
+    PRIMARY KEY (capacity_id),
+    UNIQUE KEY uq_partner_capacity_account (account_id),
+    UNIQUE KEY uq_partner_capacity_org (org_id),
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE CASCADE
+);
+
+
+CREATE TABLE order_rejections (
+    rejection_id INT NOT NULL AUTO_INCREMENT,
+    order_id INT NOT NULL,
+    account_id INT,
+    org_id INT,
+    rejected_by INT,
+    reason varchar(255) NOT NULL,
+    timed_out BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (rejection_id),
+    KEY idx_order_rejections_created_at (created_at),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE SET NULL,
+    FOREIGN KEY (rejected_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
+
+
+CREATE TABLE order_duplicates (
+    duplicate_id INT NOT NULL AUTO_INCREMENT,
+    order_id INT NOT NULL,
+    original_order_id INT NOT NULL,
+    status ENUM ('open','merged','dismissed') NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_by INT,
+    resolved_at TIMESTAMP NULL,
+    PRIMARY KEY (duplicate_id),
+    KEY idx_order_duplicates_status (status),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (original_order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
+
+
+-- Current value of one unit of a currency in the base currency set by BASE_CURRENCY
+CREATE TABLE exchange_rates (
+    currency char(3) NOT NULL,
+    base_currency char(3) NOT NULL,
+    rate decimal(18,8) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_by INT,
+    PRIMARY KEY (currency, base_currency),
+    FOREIGN KEY (updated_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
+
+-- Rates an order's totals are converted at, fixed when the order is created
+CREATE TABLE order_exchange_rates (
+    order_id INT NOT NULL,
+    currency char(3) NOT NULL,
+    base_currency char(3) NOT NULL,
+    rate decimal(18,8) NOT NULL,
+    captured_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (order_id, currency, base_currency),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE
+);
+
+-- Cash on delivery money handed over by a partner account or organisation
+CREATE TABLE cod_remittances (
+    remittance_id INT NOT NULL AUTO_INCREMENT,
+    account_id INT,
+    org_id INT,
+    remittance_date DATE NOT NULL,
+    currency char(3) NOT NULL,
+    amount decimal(12,2) NOT NULL,
+    reference varchar(255) NOT NULL DEFAULT '',
+    recorded_by INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (remittance_id),
+    KEY idx_cod_remittances_date (remittance_date),
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE RESTRICT,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE RESTRICT,
+    FOREIGN KEY (recorded_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type invitation struct {
+	InviteId    int            `json:"invite_id"`
+	Email       string         `json:"email"`
+	AccountType string         `json:"account_type"`
+	CreatedBy   sql.NullInt64  `json:"created_by"`
+	CreatedAt   string         `json:"created_at"`
+	ExpiresAt   string         `json:"expires_at"`
+	AcceptedAt  sql.NullString `json:"accepted_at"`
+	RevokedAt   sql.NullString `json:"revoked_at"`
+	Expired     bool           `json:"expired"`
+}
+
+type newInvitation struct {
+	Email       string `json:"email"`
+	AccountType string `json:"account_type"`
+}
+
+type acceptInvitation struct {
+	Token      string `json:"token"`
+	Password   string `json:"password"`
+	First_name string `json:"first_name"`
+	Last_name  string `json:"last_name"`
+}
+
+// inviteTTLHours is how long an invitation link stays valid, configurable with INVITE_TTL_HOURS (default 72)
+func inviteTTLHours() int {
+	hours, err := strconv.Atoi(os.Getenv("INVITE_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		return 72
+	}
+	return hours
+}
+
+func frontendURL() string {
+	if url := os.Getenv("FRONTEND_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:3000"
+}
+
+// Only the sha256 of an invite token is stored so a leaked table cannot be used to accept invites
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func postInvitation(c *gin.Context) {
+	var reqBody newInvitation
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	if reqBody.Email == "" || !isValidAccountType(reqBody.AccountType) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Email and a valid account_type are required"})
+		return
+	}
+
+	// Check if email already taken by an existing account
+	var existingAccountID int
+	err := db.QueryRow("SELECT account_id FROM accounts WHERE email=?", reqBody.Email).Scan(&existingAccountID)
+	if err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Email taken"})
+		return
+	} else if err != sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to check if email taken in database"})
+		return
+	}
+
+	// One pending invitation per email, so a second accepted invite cannot create a second account
+	var pendingInvite bool
+	if err := db.QueryRow("SELECT COUNT(*) > 0 FROM invitations WHERE email=? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()", reqBody.Email).Scan(&pendingInvite); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to check pending invitations in database"})
+		return
+	}
+	if pendingInvite {
+		c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "A pending invitation already exists for this email, revoke it first"})
+		return
+	}
+
+	token, err := newRandomToken()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create invitation token"})
+		return
+	}
+
+	// Save invitation with the admin who issued it
+	admin := c.MustGet("user").(user)
+	result, err := db.Exec("INSERT INTO invitations (email, account_type, token_hash, created_by, expires_at) VALUES (?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? HOUR))", reqBody.Email, reqBody.AccountType, hashToken(token), admin.Account_id, inviteTTLHours())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create invitation"})
+		return
+	}
+	inviteID, _ := result.LastInsertId()
+	inviteLink := frontendURL() + "/accept-invite?token=" + token
+
+	// Email the invite link; admin can still share it manually if sending fails
+	inviteSent := true
+	body := fmt.Sprintf("You have been invited to join GECO.\n\nSet your name and password using the link below within %d hours:\n\n%s\n", inviteTTLHours(), inviteLink)
+	if err := appMailer.Send(reqBody.Email, "You're invited to GECO", body); err != nil {
+		fmt.Println(err.Error())
+		inviteSent = false
+	}
+
+	// Respond with the link to be shared with the invitee; the raw token is never retrievable again
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Invitation Successfully Created", "inviteId": inviteID, "inviteLink": inviteLink, "inviteEmailSent": inviteSent, "expiresInHours": inviteTTLHours()})
+}
+
+func getInvitations(c *gin.Context) {
+	var invitations []invitation
+
+	// Get rows of invitations that have not been accepted or revoked
+	rows, err := db.Query("SELECT invite_id, email, account_type, created_by, created_at, expires_at, accepted_at, revoked_at, expires_at <= NOW() FROM invitations WHERE accepted_at IS NULL AND revoked_at IS NULL ORDER BY created_at DESC")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve invitations from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentInvitation invitation
+		if err := rows.Scan(&currentInvitation.InviteId, &currentInvitation.Email, &currentInvitation.AccountType, &currentInvitation.CreatedBy, &currentInvitation.CreatedAt, &currentInvitation.ExpiresAt, &currentInvitation.AcceptedAt, &currentInvitation.RevokedAt, &currentInvitation.Expired); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save invitations from DB"})
+			return
+		}
+		invitations = append(invitations, currentInvitation)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved invitations from DB", "invitations": invitations})
+}
+
+func revokeInvitation(c *gin.Context) {
+	inviteID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid invitation id"})
+		return
+	}
+
+	// Only unused invitations can be revoked
+	result, err := db.Exec("UPDATE invitations SET revoked_at=NOW() WHERE invite_id=? AND accepted_at IS NULL AND revoked_at IS NULL", inviteID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to revoke invitation in database"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No unused invitation found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Invitation Revoked Successfully", "inviteRevoked": inviteID})
+}
+
+func acceptInvite(c *gin.Context) {
+	var reqBody acceptInvitation
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	if reqBody.Token == "" || reqBody.Password == "" || reqBody.First_name == "" || reqBody.Last_name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Token, password, first_name and last_name are required"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to accept invitation"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Find a valid invitation for the token; lock it so it can only be accepted once
+	var invite invitation
+	err = tx.QueryRow("SELECT invite_id, email, account_type FROM invitations WHERE token_hash=? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW() FOR UPDATE", hashToken(reqBody.Token)).Scan(&invite.InviteId, &invite.Email, &invite.AccountType)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invitation is invalid, expired or already used"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve invitation from database"})
+		return
+	}
+
+	// The email may have been taken since the invitation was sent, e.g. through another invitation
+	var existingAccountID int
+	err = tx.QueryRow("SELECT account_id FROM accounts WHERE email=? FOR UPDATE", invite.Email).Scan(&existingAccountID)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "An account already exists for this email"})
+		return
+	} else if err != sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to check if email taken in database"})
+		return
+	}
+
+	// Hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(reqBody.Password), 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to hash password"})
+		return
+	}
+
+	// Create account and account details together
+	// Email is verified since the invite link was delivered to it
+	result, err := tx.Exec("INSERT INTO accounts (email, password, account_type, email_verified_at) VALUES (?, ?, ?, NOW())", invite.Email, string(hash), invite.AccountType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create user"})
+		return
+	}
+	accountID, err := result.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create user"})
+		return
+	}
+
+	if _, err = tx.Exec("INSERT INTO accounts_details (account_id, first_name, last_name) VALUES (?, ?, ?)", accountID, reqBody.First_name, reqBody.Last_name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create account details"})
+		return
+	}
+
+	if _, err = tx.Exec("UPDATE invitations SET accepted_at=NOW() WHERE invite_id=?", invite.InviteId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to accept invitation"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to accept invitation"})
+		return
+	}
+
+	// Respond
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Invitation Accepted Successfully", "newAccountEmailCreated": invite.Email})
+}
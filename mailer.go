@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+)
+
+// mailer sends transactional emails (verification links, invitations)
+type mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+var appMailer mailer
+
+// logMailer prints emails to stdout; used in development when no SMTP server is configured
+type logMailer struct{}
+
+func (logMailer) Send(to string, subject string, body string) error {
+	fmt.Printf("To: %s\nSubject: %s\n\n%s\n", to, subject, body)
+	return nil
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m smtpMailer) Send(to string, subject string, body string) error {
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		body + "\r\n"
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg))
+}
+
+func setupMailer() {
+	// SMTP_HOST not set => print emails to stdout
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		appMailer = logMailer{}
+		fmt.Println("Mailer: SMTP_HOST not set, emails will be logged to stdout")
+		return
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	appMailer = smtpMailer{addr: host + ":" + port, from: os.Getenv("SMTP_FROM"), auth: auth}
+	fmt.Println("Mailer: sending emails via " + host)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -22,6 +23,7 @@ var salesChannelDB *sql.DB
 // Struct for Sales Channel DB //
 
 type ordersFromSales struct {
+	SalesOrderId        int    `json:"sales_order_id"`
 	DueDate             string `json:"due_date"`
 	Completed           int    `json:"completed"`
 	OrderLength         int    `json:"order_length"`
@@ -51,10 +53,26 @@ type ordersFromSales struct {
 //=================================//
 
 type user struct {
-	Account_id   int    `json:"account_id"`
-	Email        string `json:"email"`
-	Password     string `json:"password"`
-	Account_Type string `json:"account_type"`
+	Account_id     int            `json:"account_id"`
+	Email          string         `json:"email"`
+	Password       string         `json:"password"`
+	Account_Type   string         `json:"account_type"`
+	Email_Verified bool           `json:"email_verified"`
+	Is_Admin       bool           `json:"is_admin"`
+	Org_id         sql.NullInt64  `json:"org_id"`
+	Org_Role       sql.NullString `json:"org_role"`
+}
+
+// Columns of an account joined with its role, in the order read by scanAccount
+const selectAccountSQL = "SELECT account_id, email, password, account_type, email_verified_at IS NOT NULL, COALESCE(roles.is_admin, FALSE), org_id, org_role FROM accounts LEFT JOIN roles ON roles.role_name = accounts.account_type"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccount(row rowScanner, account *user) error {
+	return row.Scan(&account.Account_id, &account.Email, &account.Password, &account.Account_Type, &account.Email_Verified, &account.Is_Admin, &account.Org_id, &account.Org_Role)
 }
 
 type emailPassword struct {
@@ -83,40 +101,133 @@ type email struct {
 type orderIdAccountId struct {
 	OrderId   int `json:"order_id"`
 	AccountId int `json:"account_id"`
+	OrgId     int `json:"org_id"`
 }
 
-type orderIdCompleted struct {
-	OrderId   int `json:"order_id"`
-	Completed int `json:"completed"`
+type orderIdStatus struct {
+	OrderId  int    `json:"order_id"`
+	Status   string `json:"status"`
+	Note     string `json:"note"`
+	Location string `json:"location"`
+	// Cash collected, required when delivering a cash on delivery order
+	CodCollectedAmount *float64 `json:"cod_collected_amount"`
 }
 
 type order struct {
 	OrderId   int           `json:"order_id"`
 	AccountId sql.NullInt64 `json:"account_id,omitempty"`
 	// AccountId           int    `json:"account_id"`
-	OrderLength         int    `json:"order_length"`
-	OrderWidth          int    `json:"order_width"`
-	OrderHeight         int    `json:"order_height"`
-	OrderWeight         int    `json:"order_weight"`
-	ConsigneeName       string `json:"consignee_name"`
-	ConsigneeNumber     string `json:"consignee_number"`
-	ConsigneeCountry    string `json:"consignee_country"`
-	ConsigneeAddress    string `json:"consignee_address"`
-	ConsigneePostal     string `json:"consignee_postal"`
-	ConsigneeState      string `json:"consignee_state"`
-	ConsigneeCity       string `json:"consignee_city"`
-	ConsigneeProvince   string `json:"consignee_province"`
-	ConsigneeEmail      string `json:"consignee_email"`
-	PickupContactName   string `json:"pickup_contact_name"`
-	PickupContactNumber string `json:"pickup_contact_number"`
-	PickupCountry       string `json:"pickup_country"`
-	PickupAddress       string `json:"pickup_address"`
-	PickupPostal        string `json:"pickup_postal"`
-	PickupState         string `json:"pickup_state"`
-	PickupCity          string `json:"pickup_city"`
-	PickupProvince      string `json:"pickup_province"`
-	DueDate             string `json:"due_date"`
-	Completed           int    `json:"completed"`
+	OrderLength         int            `json:"order_length"`
+	OrderWidth          int            `json:"order_width"`
+	OrderHeight         int            `json:"order_height"`
+	OrderWeight         int            `json:"order_weight"`
+	ConsigneeName       string         `json:"consignee_name"`
+	ConsigneeNumber     string         `json:"consignee_number"`
+	ConsigneeCountry    string         `json:"consignee_country"`
+	ConsigneeAddress    string         `json:"consignee_address"`
+	ConsigneePostal     string         `json:"consignee_postal"`
+	ConsigneeState      string         `json:"consignee_state"`
+	ConsigneeCity       string         `json:"consignee_city"`
+	ConsigneeProvince   string         `json:"consignee_province"`
+	ConsigneeEmail      string         `json:"consignee_email"`
+	PickupContactName   string         `json:"pickup_contact_name"`
+	PickupContactNumber string         `json:"pickup_contact_number"`
+	PickupCountry       string         `json:"pickup_country"`
+	PickupAddress       string         `json:"pickup_address"`
+	PickupPostal        string         `json:"pickup_postal"`
+	PickupState         string         `json:"pickup_state"`
+	PickupCity          string         `json:"pickup_city"`
+	PickupProvince      string         `json:"pickup_province"`
+	DueDate             time.Time      `json:"due_date"`
+	Status              string         `json:"status"`
+	OrgId               sql.NullInt64  `json:"org_id"`
+	CancelReason        sql.NullString `json:"cancel_reason"`
+	CreatedAt           time.Time      `json:"created_at"`
+	Version             int            `json:"version"`
+	// Set when auto-assignment found no partner with capacity for the order
+	NeedsManualAssignment bool `json:"needs_manual_assignment"`
+	// When the order was last assigned, starting the partner's acceptance window
+	AssignedAt sql.NullString `json:"assigned_at"`
+	// Postcodes not matching their state, flagged for review
+	AddressWarning sql.NullString `json:"address_warning"`
+	// Phone numbers in E.164, NULL for orders the backfill could not parse
+	ConsigneeNumberE164     sql.NullString `json:"consignee_number_e164"`
+	PickupContactNumberE164 sql.NullString `json:"pickup_contact_number_e164"`
+	// Due date in the display timezone of the region covering the consignee country
+	DisplayTimezone string `json:"display_timezone,omitempty"`
+	DueDateLocal    string `json:"due_date_local,omitempty"`
+	// on_track, at_risk or breached; NULL until the SLA job first sees the order
+	SLAStatus sql.NullString `json:"sla_status"`
+	// Weight of the parcel's volume at its partner's divisor, and the greater of that and order_weight
+	VolumetricWeight float64 `json:"volumetric_weight"`
+	ChargeableWeight float64 `json:"chargeable_weight"`
+	// Units of the dimensions and weights above, set by ORDER_UNITS
+	LengthUnit string `json:"length_unit"`
+	WeightUnit string `json:"weight_unit"`
+	// Delivery cost quoted from a partner rate card when the order was created
+	ShippingCost     sql.NullFloat64 `json:"shipping_cost"`
+	ShippingCurrency sql.NullString  `json:"shipping_currency"`
+	RateCardId       sql.NullInt64   `json:"rate_card_id"`
+	// Cash due from the consignee on delivery, NULL for prepaid orders, and what the partner recorded collecting
+	CodAmount          sql.NullFloat64 `json:"cod_amount"`
+	CodCurrency        sql.NullString  `json:"cod_currency"`
+	CodCollectedAmount sql.NullFloat64 `json:"cod_collected_amount"`
+	CodCollectedAt     sql.NullTime    `json:"cod_collected_at"`
+	CodDiscrepancy     bool            `json:"cod_discrepancy"`
+}
+
+// Columns of an order, in the order read by scanOrder
+const selectOrderSQL = "SELECT orders.order_id, orders.account_id, order_length, order_width, order_height, order_weight, consignee_name, consignee_number, consignee_country, consignee_address, consignee_postal, consignee_state, consignee_city, consignee_province, consignee_email, pickup_contact_name, pickup_contact_number, pickup_country, pickup_address, pickup_postal, pickup_state, pickup_city, pickup_province, due_date, status, orders.org_id, cancel_reason, orders.created_at, orders.version, orders.needs_manual_assignment, orders.assigned_at, orders.address_warning, orders.consignee_number_e164, orders.pickup_contact_number_e164, orders.sla_status, orders.volumetric_weight, orders.chargeable_weight, orders.shipping_cost, orders.shipping_currency, orders.rate_card_id, orders.cod_amount, orders.cod_currency, orders.cod_collected_amount, orders.cod_collected_at, orders.cod_discrepancy FROM orders"
+
+func scanOrder(row rowScanner, currentOrder *order) error {
+	units := orderUnits()
+	currentOrder.LengthUnit, currentOrder.WeightUnit = units.Length, units.Weight
+	return row.Scan(
+		&currentOrder.OrderId,
+		&currentOrder.AccountId,
+		&currentOrder.OrderLength,
+		&currentOrder.OrderWidth,
+		&currentOrder.OrderHeight,
+		&currentOrder.OrderWeight,
+		&currentOrder.ConsigneeName,
+		&currentOrder.ConsigneeNumber,
+		&currentOrder.ConsigneeCountry,
+		&currentOrder.ConsigneeAddress,
+		&currentOrder.ConsigneePostal,
+		&currentOrder.ConsigneeState,
+		&currentOrder.ConsigneeCity,
+		&currentOrder.ConsigneeProvince,
+		&currentOrder.ConsigneeEmail,
+		&currentOrder.PickupContactName,
+		&currentOrder.PickupContactNumber,
+		&currentOrder.PickupCountry,
+		&currentOrder.PickupAddress,
+		&currentOrder.PickupPostal,
+		&currentOrder.PickupState,
+		&currentOrder.PickupCity,
+		&currentOrder.PickupProvince,
+		&currentOrder.DueDate,
+		&currentOrder.Status,
+		&currentOrder.OrgId,
+		&currentOrder.CancelReason,
+		&currentOrder.CreatedAt,
+		&currentOrder.Version,
+		&currentOrder.NeedsManualAssignment,
+		&currentOrder.AssignedAt,
+		&currentOrder.AddressWarning,
+		&currentOrder.ConsigneeNumberE164,
+		&currentOrder.PickupContactNumberE164,
+		&currentOrder.SLAStatus,
+		&currentOrder.VolumetricWeight,
+		&currentOrder.ChargeableWeight,
+		&currentOrder.ShippingCost,
+		&currentOrder.ShippingCurrency,
+		&currentOrder.RateCardId,
+		&currentOrder.CodAmount,
+		&currentOrder.CodCurrency,
+		&currentOrder.CodCollectedAmount,
+		&currentOrder.CodCollectedAt,
+		&currentOrder.CodDiscrepancy)
 }
 
 type orderWithoutId struct {
@@ -143,7 +254,7 @@ type orderWithoutId struct {
 	PickupCity          string `json:"pickup_city"`
 	PickupProvince      string `json:"pickup_province"`
 	DueDate             string `json:"due_date"`
-	Completed           int    `json:"completed"`
+	Status              string `json:"status"`
 }
 
 type newOrderFromFrontend struct {
@@ -170,7 +281,13 @@ type newOrderFromFrontend struct {
 	PickupCity          string `json:"pickup_city"`
 	PickupProvince      string `json:"pickup_province"`
 	DueDate             string `json:"due_date"`
-	Completed           int    `json:"completed"`
+	// Cash to collect from the consignee on delivery; 0 for prepaid orders
+	CodAmount   float64 `json:"cod_amount"`
+	CodCurrency string  `json:"cod_currency"`
+	// Set by validateNewOrder from the numbers and due date as typed
+	ConsigneeNumberE164     string    `json:"-"`
+	PickupContactNumberE164 string    `json:"-"`
+	DueAt                   time.Time `json:"-"`
 }
 
 func setupSalesChannelDBConnection() {
@@ -180,6 +297,10 @@ func setupSalesChannelDBConnection() {
 		Net:    "tcp",
 		Addr:   "127.0.0.1:3306",
 		DBName: "capstonesaleschanneldb",
+		// Read timestamps as time.Time in UTC
+		ParseTime: true,
+		Loc:       time.UTC,
+		Params:    map[string]string{"time_zone": "'+00:00'"},
 	}
 
 	var err error
@@ -202,6 +323,10 @@ func setupDBConnection() {
 		Net:    "tcp",
 		Addr:   "127.0.0.1:3306",
 		DBName: "capstonedb",
+		// Store and read timestamps in UTC, as time.Time
+		ParseTime: true,
+		Loc:       time.UTC,
+		Params:    map[string]string{"time_zone": "'+00:00'"},
 	}
 
 	var err error
@@ -218,36 +343,143 @@ func setupDBConnection() {
 }
 
 func main() {
+	// go run . -backfill-phones normalises phone numbers of existing orders to E.164, then exits
+	backfillPhones := flag.Bool("backfill-phones", false, "normalise phone numbers of existing orders to E.164 and exit")
+	// go run . -backfill-weights recomputes volumetric and chargeable weights of existing orders, then exits
+	backfillWeights := flag.Bool("backfill-weights", false, "recompute volumetric and chargeable weights of existing orders and exit")
+	// go run . -import-exchange-rates rates.csv loads currency,rate lines against BASE_CURRENCY, then exits
+	exchangeRatesFile := flag.String("import-exchange-rates", "", "import exchange rates from a CSV file of currency,rate lines and exit")
+	flag.Parse()
+	if *backfillPhones {
+		setupDBConnection()
+		if err := backfillPhoneNumbers(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *backfillWeights {
+		setupDBConnection()
+		if err := backfillOrderWeights(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *exchangeRatesFile != "" {
+		setupDBConnection()
+		if err := importExchangeRates(*exchangeRatesFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	setupSalesChannelDBConnection()
 	setupDBConnection()
+	setupMailer()
+
+	// Background job sending assigned orders back to admins when partners do not accept them in time
+	startAcceptanceTimeoutJob()
+
+	// Background job keeping the SLA status of open orders up to date
+	startSLAJob()
 
 	router := gin.Default()
 
-	// To enable CORS Support
+	// To enable CORS Support for the configured frontend origins only
+	allowedOrigins = loadAllowedOrigins()
 	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
+	config.AllowOrigins = allowedOrigins
 	config.AllowCredentials = true
+	config.AddAllowHeaders(csrfHeaderName, "If-Match")
+	config.AddExposeHeaders("ETag")
 	router.Use(cors.New(config))
 
+	// CSRF protection for cookie authenticated PATCH/POST/DELETE requests
+	router.Use(csrf)
+
 	// Route to pull orders from sales channel DB
 	router.GET("/pull-orders-from-sales-channel", getOrdersFromSales)
 
 	// Routes related to user account login and creation
 	router.POST("/login", login)
 	router.GET("/accounts", getAccounts)
-	router.POST("/new-account", postAccount)
+	router.POST("/new-account", auth, requireAdmin, postAccount)
 	router.GET("/is-logged-in", auth, accountIsLoggedIn)
+	router.GET("/verify-email", verifyEmail)
+	router.POST("/resend-verification", resendVerification)
 	// router.PATCH("/update-account-password", updateAccountPassword)
 	// router.DELETE("/delete-account", deleteAccount) only Admin
 	// router.PATCH("/update-account-details", updateAccountDetails)
 	router.POST("/new-account-details", postAccountDetails)
 	router.GET("/account-details", getAccountDetails)
 
+	// Routes related to partner invitations
+	router.POST("/invitations", auth, requireAdmin, postInvitation)
+	router.GET("/invitations", auth, requireAdmin, getInvitations)
+	router.DELETE("/invitations/:id", auth, requireAdmin, revokeInvitation)
+	router.POST("/accept-invite", acceptInvite)
+
+	// Routes related to roles and partner regions (admin only)
+	router.GET("/roles", auth, requireAdmin, getRoles)
+	router.POST("/roles", auth, requireAdmin, postRole)
+	router.PATCH("/roles/:id", auth, requireAdmin, updateRole)
+	router.DELETE("/roles/:id", auth, requireAdmin, deleteRole)
+	router.GET("/regions", auth, requireAdmin, getRegions)
+	router.POST("/regions", auth, requireAdmin, postRegion)
+	router.PATCH("/regions/:id", auth, requireAdmin, updateRegion)
+	router.DELETE("/regions/:id", auth, requireAdmin, deleteRegion)
+
+	// Routes related to partner organisations
+	router.GET("/organisations", auth, requireAdmin, getOrganisations)
+	router.POST("/organisations", auth, requireAdmin, postOrganisation)
+	router.POST("/organisations/:id/members", auth, requireAdmin, addOrganisationMember)
+	router.GET("/my-organisation/users", auth, requireOrgAdmin, getMyOrganisationUsers)
+	router.POST("/my-organisation/users", auth, requireOrgAdmin, postMyOrganisationUser)
+	router.PATCH("/my-organisation/users/:id", auth, requireOrgAdmin, updateMyOrganisationUser)
+	router.DELETE("/my-organisation/users/:id", auth, requireOrgAdmin, removeMyOrganisationUser)
+	router.PATCH("/my-organisation/assign-order", auth, requireOrgAdmin, assignMyOrganisationOrder)
+
 	// Routes related to orders
-	router.GET("/orders", getOrders)
+	router.GET("/orders", auth, getOrders)
+	router.GET("/orders/search", auth, searchOrders)
 	router.POST("/new-order", postOrder)
-	router.PATCH("/update-order-status", updateOrderStatus)
-	router.PATCH("/assign-order", assignOrder)
+	router.PATCH("/update-order-status", auth, updateOrderStatus)
+	router.PATCH("/assign-order", auth, requireAdmin, assignOrder)
+	router.POST("/orders/bulk-assign", auth, requireAdmin, bulkAssignOrders)
+	router.POST("/orders/bulk-status", auth, bulkUpdateOrderStatus)
+	router.GET("/orders/:id", auth, getOrder)
+	router.PATCH("/orders/:id", auth, requireAdmin, updateOrder)
+	router.DELETE("/orders/:id", auth, requireAdmin, cancelOrder)
+	router.GET("/orders/:id/timeline", auth, getOrderTimeline)
+	router.POST("/orders/:id/accept", auth, acceptOrder)
+	router.POST("/orders/:id/reject", auth, rejectOrder)
+	router.GET("/reports/order-rejections", auth, requireAdmin, getRejectionReport)
+	router.GET("/order-duplicates", auth, requireAdmin, getOrderDuplicates)
+	router.POST("/order-duplicates/:id/merge", auth, requireAdmin, mergeOrderDuplicate)
+	router.POST("/order-duplicates/:id/dismiss", auth, requireAdmin, dismissOrderDuplicate)
+
+	// Automatic assignment rules
+	router.GET("/assignment-rules", auth, requireAdmin, getAssignmentRules)
+	router.POST("/assignment-rules", auth, requireAdmin, postAssignmentRule)
+	router.POST("/assignment-rules/simulate", auth, requireAdmin, simulateAssignmentRules)
+	router.PATCH("/assignment-rules/:id", auth, requireAdmin, updateAssignmentRule)
+	router.DELETE("/assignment-rules/:id", auth, requireAdmin, deleteAssignmentRule)
+	router.GET("/partner-capacity", auth, requireAdmin, getPartnerCapacities)
+	router.PUT("/partner-capacity", auth, requireAdmin, putPartnerCapacity)
+	router.DELETE("/partner-capacity/:id", auth, requireAdmin, deletePartnerCapacity)
+
+	// Partner rate cards and delivery quotes
+	router.GET("/rate-cards", auth, requireAdmin, getRateCards)
+	router.PUT("/rate-cards", auth, requireAdmin, putRateCard)
+	router.DELETE("/rate-cards/:id", auth, requireAdmin, deleteRateCard)
+	router.POST("/quotes", postQuote)
+
+	// Exchange rates against BASE_CURRENCY for order totals
+	router.GET("/exchange-rates", auth, requireAdmin, getExchangeRates)
+	router.PUT("/exchange-rates", auth, requireAdmin, putExchangeRates)
+
+	// Cash on delivery remittances and reconciliation
+	router.POST("/cod-remittances", auth, requireAdmin, postCODRemittance)
+	router.GET("/reports/cod-reconciliation", auth, requireAdmin, getCODReconciliation)
 
 	router.Run("localhost:8080")
 }
@@ -256,7 +488,7 @@ func getOrdersFromSales(c *gin.Context) {
 	var orders []ordersFromSales
 
 	// Get rows of orders with all details from capstone
-	rows, err := salesChannelDB.Query("SELECT due_date, completed, order_length,order_width,order_height,order_weight,consignee_name,consignee_number,consignee_country,consignee_address,consignee_postal,consignee_state,consignee_city,consignee_province,consignee_email,pickup_contact_name,pickup_contact_number,pickup_country,pickup_address,pickup_postal,pickup_state,pickup_city,pickup_province FROM orders JOIN order_details ON order_details.order_id = orders.order_id JOIN consignee_details ON consignee_details.order_id = orders.order_id JOIN pickup_details ON pickup_details.order_id = orders.order_id")
+	rows, err := salesChannelDB.Query("SELECT orders.order_id, due_date, completed, order_length,order_width,order_height,order_weight,consignee_name,consignee_number,consignee_country,consignee_address,consignee_postal,consignee_state,consignee_city,consignee_province,consignee_email,pickup_contact_name,pickup_contact_number,pickup_country,pickup_address,pickup_postal,pickup_state,pickup_city,pickup_province FROM orders JOIN order_details ON order_details.order_id = orders.order_id JOIN consignee_details ON consignee_details.order_id = orders.order_id JOIN pickup_details ON pickup_details.order_id = orders.order_id")
 	// if err from getting rows of orders from DB, return HTTP Bad Request 400
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve orders from DB"})
@@ -267,6 +499,7 @@ func getOrdersFromSales(c *gin.Context) {
 		var currentOrder ordersFromSales
 		// scan each row of order and save to currentOrder
 		if err := rows.Scan(
+			&currentOrder.SalesOrderId,
 			&currentOrder.DueDate,
 			&currentOrder.Completed,
 			&currentOrder.OrderLength,
@@ -299,17 +532,72 @@ func getOrdersFromSales(c *gin.Context) {
 	}
 
 	// INSERT each order from orders slice into capstonedb (client's db)
-	for _, value := range orders {
-		_, err := db.Exec("INSERT INTO orders (order_length, order_width, order_height, order_weight, consignee_name, consignee_number, consignee_country, consignee_address, consignee_postal, consignee_state, consignee_city, consignee_province, consignee_email, pickup_contact_name, pickup_contact_number, pickup_country, pickup_address, pickup_postal, pickup_state, pickup_city, pickup_province, due_date, completed) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", value.OrderLength, value.OrderWidth, value.OrderHeight, value.OrderWeight, value.ConsigneeName, value.ConsigneeNumber, value.ConsigneeCountry, value.ConsigneeAddress, value.ConsigneePostal, value.ConsigneeState, value.ConsigneeCity, value.ConsigneeProvince, value.ConsigneeEmail, value.PickupContactName, value.PickupContactNumber, value.PickupCountry, value.PickupAddress, value.PickupPostal, value.PickupState, value.PickupCity, value.PickupProvince, value.DueDate, value.Completed)
+	assigned := 0
+	alreadyImported := 0
+	var rejected []importRejection
+	for index, value := range orders {
+		// Orders pulled before are skipped, so pulling again does not create them twice or flag them as duplicates
+		var imported bool
+		if err := db.QueryRow("SELECT COUNT(*) > 0 FROM orders WHERE sales_order_id=?", value.SalesOrderId).Scan(&imported); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve orders from DB"})
+			return
+		}
+		if imported {
+			alreadyImported++
+			continue
+		}
+
+		// Orders failing validation are skipped and reported; completed orders may be past due
+		newOrder := value.newOrder()
+		errs, addressWarnings, err := validateNewOrder(&newOrder, time.Now(), value.Completed != 0)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to validate order"})
+			return
+		}
+		if len(errs) > 0 {
+			rejected = append(rejected, importRejection{Index: index, Errors: errs})
+			continue
+		}
+
+		// Insert the normalised order, flagging addresses whose postcode does not match the state.
+		// Imported orders have no partner yet, so their volumetric weight uses the default divisor.
+		volumetricWeight, chargeableWeight := orderWeights(newOrder.OrderLength, newOrder.OrderWidth, newOrder.OrderHeight, newOrder.OrderWeight, defaultVolumetricDivisor())
+		result, err := db.Exec("INSERT INTO orders (order_length, order_width, order_height, order_weight, consignee_name, consignee_number, consignee_country, consignee_address, consignee_postal, consignee_state, consignee_city, consignee_province, consignee_email, pickup_contact_name, pickup_contact_number, pickup_country, pickup_address, pickup_postal, pickup_state, pickup_city, pickup_province, due_date, status, address_warning, consignee_number_e164, pickup_contact_number_e164, fingerprint, volumetric_weight, chargeable_weight, sales_order_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", newOrder.OrderLength, newOrder.OrderWidth, newOrder.OrderHeight, newOrder.OrderWeight, newOrder.ConsigneeName, newOrder.ConsigneeNumber, newOrder.ConsigneeCountry, newOrder.ConsigneeAddress, newOrder.ConsigneePostal, newOrder.ConsigneeState, newOrder.ConsigneeCity, newOrder.ConsigneeProvince, newOrder.ConsigneeEmail, newOrder.PickupContactName, newOrder.PickupContactNumber, newOrder.PickupCountry, newOrder.PickupAddress, newOrder.PickupPostal, newOrder.PickupState, newOrder.PickupCity, newOrder.PickupProvince, newOrder.DueAt, statusFromSalesCompleted(value.Completed), addressWarning(addressWarnings), newOrder.ConsigneeNumberE164, newOrder.PickupContactNumberE164, orderFingerprint(newOrder), volumetricWeight, chargeableWeight, value.SalesOrderId)
 		if err != nil {
 			fmt.Println(err.Error())
 			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create order in DB"})
 			return
 		}
+
+		orderID, _ := result.LastInsertId()
+
+		// Fix the exchange rates the order's totals are converted at
+		if err := snapshotExchangeRates(db, orderID); err != nil {
+			fmt.Println(err.Error())
+		}
+
+		// Queue probable duplicates, e.g. the same parcel also entered through /new-order, for review
+		if _, err := flagDuplicateOrders(orderID, orderFingerprint(newOrder)); err != nil {
+			fmt.Println(err.Error())
+		}
+
+		// Imported orders still pending are assigned by the first matching assignment rule
+		rule, err := autoAssignOrder(int(orderID))
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+
+		// Price the delivery with the assigned partner's rate card
+		if _, err := storeOrderShippingCost(db, orderID); err != nil {
+			fmt.Println(err.Error())
+		}
+		if rule != nil {
+			assigned++
+		}
 	}
 
 	// Respond
-	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully pulled orders from sales channel", "orders": orders})
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully pulled orders from sales channel", "orders": orders, "autoAssigned": assigned, "alreadyImported": alreadyImported, "rejected": rejected})
 }
 
 func login(c *gin.Context) {
@@ -325,14 +613,14 @@ func login(c *gin.Context) {
 	}
 
 	// Look up email of login account in accounts database and retrieve account id, email, password, account_type
-	rows, err := db.Query("SELECT * FROM accounts WHERE email=?", reqBody.Email)
+	rows, err := db.Query(selectAccountSQL+" WHERE email=?", reqBody.Email)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve login credentials in database"})
 		return
 	}
 	if rows.Next() {
 		// Account found with email provided
-		rows.Scan(&accountFoundInDB.Account_id, &accountFoundInDB.Email, &accountFoundInDB.Password, &accountFoundInDB.Account_Type)
+		scanAccount(rows, &accountFoundInDB)
 	} else {
 		// No Account found with email provided
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid email or password"})
@@ -361,6 +649,12 @@ func login(c *gin.Context) {
 		return
 	}
 
+	// Block login until the account email has been verified
+	if !accountFoundInDB.Email_Verified {
+		c.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": "Email not verified", "emailVerified": false})
+		return
+	}
+
 	// Generate JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": accountFoundInDB.Email,
@@ -379,8 +673,15 @@ func login(c *gin.Context) {
 	c.SetSameSite(http.SameSiteLaxMode)
 	c.SetCookie("Authorisation", tokenString, 3600*24, "", "", false, true)
 
+	// Set CSRF token as cookie; frontend must echo it back in the X-CSRF-Token header
+	csrfToken, err := setCSRFCookie(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create CSRF token"})
+		return
+	}
+
 	// Return HTTP OK 200
-	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Login successful", "firstName": accountDetailsFoundInDB.First_name, "lastName": accountDetailsFoundInDB.Last_name, "accountType": accountFoundInDB.Account_Type, "accessToken": tokenString})
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Login successful", "firstName": accountDetailsFoundInDB.First_name, "lastName": accountDetailsFoundInDB.Last_name, "accountType": accountFoundInDB.Account_Type, "isAdmin": accountFoundInDB.Is_Admin, "accessToken": tokenString, "csrfToken": csrfToken})
 }
 
 func accountIsLoggedIn(c *gin.Context) {
@@ -394,33 +695,44 @@ func auth(c *gin.Context) {
 	tokenString, err := c.Cookie("Authorisation")
 	if err != nil {
 		c.AbortWithStatus(http.StatusUnauthorized)
+		return
 	}
 
 	// Decode and validate cookie
-	token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
 		return []byte(os.Getenv("SECRET")), nil
 	})
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		// Cookie successfully validated, user account has access
 
+		// Tokens issued for other purposes (e.g. email verification links) are not login sessions
+		if _, hasPurpose := claims["purpose"]; hasPurpose {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
 		// Check cookie expiration
 		if float64(time.Now().Unix()) > claims["exp"].(float64) {
 			// Abort if cookie expired (current time greater than cookie expiration)
 			c.AbortWithStatus(http.StatusUnauthorized)
+			return
 		}
 
 		// Find user account with token sub
 		var foundAccount user
-		if err := db.QueryRow("SELECT * FROM accounts WHERE email=?", claims["sub"]).Scan(&foundAccount.Account_id, &foundAccount.Email, &foundAccount.Password, &foundAccount.Account_Type); err != nil {
+		if err := scanAccount(db.QueryRow(selectAccountSQL+" WHERE email=?", claims["sub"]), &foundAccount); err != nil {
 			// account email not found
-			if err == sql.ErrNoRows {
-				c.AbortWithStatus(http.StatusUnauthorized)
-			}
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
 		}
 
 		// Attach user account to request
@@ -434,11 +746,23 @@ func auth(c *gin.Context) {
 	}
 }
 
+func requireAdmin(c *gin.Context) {
+	// Must run after auth, which attaches the logged in user account to the request
+	currentUser, exists := c.Get("user")
+	if !exists || !currentUser.(user).Is_Admin {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": "Admin access required"})
+		return
+	}
+
+	// Continue
+	c.Next()
+}
+
 func getAccounts(c *gin.Context) {
 	var accounts []user
 
 	// Get rows of accounts from DB
-	rows, err := db.Query("SELECT * FROM accounts")
+	rows, err := db.Query(selectAccountSQL)
 	// if err from getting rows of accounts from DB, return HTTP Bad Request 400
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve accounts from DB"})
@@ -448,7 +772,7 @@ func getAccounts(c *gin.Context) {
 	for rows.Next() {
 		var account user
 		// scan each row of accounts and save to account
-		if err := rows.Scan(&account.Account_id, &account.Email, &account.Password, &account.Account_Type); err != nil {
+		if err := scanAccount(rows, &account); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save accounts from DB"})
 			return
 		}
@@ -470,8 +794,14 @@ func postAccount(c *gin.Context) {
 		return
 	}
 
+	// Returns Error HTTP Bad Request 400 if account type is not recognised
+	if !isValidAccountType(reqBody.Account_Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid account type"})
+		return
+	}
+
 	// Check if email already taken
-	rows, err := db.Query("SELECT * FROM accounts WHERE email=?", reqBody.Email)
+	rows, err := db.Query("SELECT account_id FROM accounts WHERE email=?", reqBody.Email)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to check if email taken in database"})
 		return
@@ -497,14 +827,23 @@ func postAccount(c *gin.Context) {
 		newAccount.Password = string(hash)
 		newAccount.Account_Type = reqBody.Account_Type
 
-		_, err = db.Exec("INSERT INTO accounts (email, password, account_type) VALUES (?, ?, ?)", newAccount.Email, newAccount.Password, newAccount.Account_Type)
+		// New accounts start unverified (email_verified_at NULL)
+		result, err := db.Exec("INSERT INTO accounts (email, password, account_type) VALUES (?, ?, ?)", newAccount.Email, newAccount.Password, newAccount.Account_Type)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create user"})
 			return
 		}
+		accountID, _ := result.LastInsertId()
+
+		// Send verification link; account can be re-sent a link via /resend-verification if this fails
+		verificationSent := true
+		if err := sendVerificationEmail(int(accountID), newAccount.Email); err != nil {
+			fmt.Println(err.Error())
+			verificationSent = false
+		}
 
 		// Respond
-		c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "newAccountEmailCreated": newAccount.Email})
+		c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "newAccountEmailCreated": newAccount.Email, "verificationEmailSent": verificationSent})
 	}
 }
 
@@ -593,6 +932,17 @@ func postOrder(c *gin.Context) {
 		return
 	}
 
+	// Returns Error HTTP Unprocessable Entity 422 listing every invalid field
+	errs, addressWarnings, err := validateNewOrder(&reqBody, time.Now(), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to validate order"})
+		return
+	}
+	if len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
 	// Create the order in database
 	var newOrder orderWithoutId
 	newOrder.AccountId = reqBody.AccountId
@@ -617,24 +967,87 @@ func postOrder(c *gin.Context) {
 	newOrder.PickupState = reqBody.PickupState
 	newOrder.PickupCity = reqBody.PickupCity
 	newOrder.PickupProvince = reqBody.PickupProvince
-	newOrder.DueDate = reqBody.DueDate
-	newOrder.Completed = reqBody.Completed
+	newOrder.DueDate = reqBody.DueAt.Format(time.RFC3339)
+
+	// New orders start pending, or assigned when created for a partner account
+	var accountID sql.NullInt64
+	newOrder.Status = statusPending
+	if newOrder.AccountId != 0 {
+		accountID = sql.NullInt64{Int64: int64(newOrder.AccountId), Valid: true}
+		newOrder.Status = statusAssigned
+	}
 
-	_, err := db.Exec("INSERT INTO orders (account_id, order_length, order_width, order_height, order_weight, consignee_name, consignee_number, consignee_country, consignee_address, consignee_postal, consignee_state, consignee_city, consignee_province, consignee_email, pickup_contact_name, pickup_contact_number, pickup_country, pickup_address, pickup_postal, pickup_state, pickup_city, pickup_province, due_date, completed) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", newOrder.AccountId, newOrder.OrderLength, newOrder.OrderWidth, newOrder.OrderHeight, newOrder.OrderWeight, newOrder.ConsigneeName, newOrder.ConsigneeNumber, newOrder.ConsigneeCountry, newOrder.ConsigneeAddress, newOrder.ConsigneePostal, newOrder.ConsigneeState, newOrder.ConsigneeCity, newOrder.ConsigneeProvince, newOrder.ConsigneeEmail, newOrder.PickupContactName, newOrder.PickupContactNumber, newOrder.PickupCountry, newOrder.PickupAddress, newOrder.PickupPostal, newOrder.PickupState, newOrder.PickupCity, newOrder.PickupProvince, newOrder.DueDate, newOrder.Completed)
+	// Volumetric weight uses the divisor of the partner the order is created for
+	divisor, err := partnerVolumetricDivisor(db, accountID, sql.NullInt64{})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create order"})
 		return
 	}
+	volumetricWeight, chargeableWeight := orderWeights(newOrder.OrderLength, newOrder.OrderWidth, newOrder.OrderHeight, newOrder.OrderWeight, divisor)
+	codAmount, codCurrency := reqBody.codAmount()
+
+	result, err := db.Exec("INSERT INTO orders (account_id, order_length, order_width, order_height, order_weight, consignee_name, consignee_number, consignee_country, consignee_address, consignee_postal, consignee_state, consignee_city, consignee_province, consignee_email, pickup_contact_name, pickup_contact_number, pickup_country, pickup_address, pickup_postal, pickup_state, pickup_city, pickup_province, due_date, status, assigned_at, address_warning, consignee_number_e164, pickup_contact_number_e164, fingerprint, volumetric_weight, chargeable_weight, cod_amount, cod_currency) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, IF(?, NOW(), NULL), ?, ?, ?, ?, ?, ?, ?, ?)", accountID, newOrder.OrderLength, newOrder.OrderWidth, newOrder.OrderHeight, newOrder.OrderWeight, newOrder.ConsigneeName, newOrder.ConsigneeNumber, newOrder.ConsigneeCountry, newOrder.ConsigneeAddress, newOrder.ConsigneePostal, newOrder.ConsigneeState, newOrder.ConsigneeCity, newOrder.ConsigneeProvince, newOrder.ConsigneeEmail, newOrder.PickupContactName, newOrder.PickupContactNumber, newOrder.PickupCountry, newOrder.PickupAddress, newOrder.PickupPostal, newOrder.PickupState, newOrder.PickupCity, newOrder.PickupProvince, reqBody.DueAt, newOrder.Status, accountID.Valid, addressWarning(addressWarnings), reqBody.ConsigneeNumberE164, reqBody.PickupContactNumberE164, orderFingerprint(reqBody), volumetricWeight, chargeableWeight, codAmount, codCurrency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create order"})
+		return
+	}
+	orderID, _ := result.LastInsertId()
+
+	// Fix the exchange rates the order's totals are converted at
+	if err := snapshotExchangeRates(db, orderID); err != nil {
+		fmt.Println(err.Error())
+	}
+
+	// Flag probable duplicates of earlier orders for review; the order is still created
+	duplicateOf, err := flagDuplicateOrders(orderID, orderFingerprint(reqBody))
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+
+	// Orders created without a partner are assigned by the first matching assignment rule
+	var matchedRule *assignmentRule
+	if newOrder.AccountId == 0 {
+		matchedRule, err = autoAssignOrder(int(orderID))
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+
+	// Price the delivery with the assigned partner's rate card, or the cheapest covering one
+	quote, err := storeOrderShippingCost(db, orderID)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
 
 	// Respond
-	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "New Order Successfully Created", "newOrderCreated": newOrder})
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "New Order Successfully Created", "newOrderCreated": newOrder, "orderId": orderID, "volumetricWeight": volumetricWeight, "chargeableWeight": chargeableWeight, "shippingQuote": quote, "assignmentRule": matchedRule, "addressWarnings": addressWarnings, "possibleDuplicateOf": duplicateOf})
 }
 
 func getOrders(c *gin.Context) {
 	var orders []order
+	var total int
+	currentUser := c.MustGet("user").(user)
+
+	// Build filters, pagination and sorting from the query string
+	where, args, err := buildOrderFilter(c.Request.URL.Query(), currentUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+	page, err := parseOrderPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+
+	// Count all matching orders for the frontend's pager
+	if err := db.QueryRow("SELECT COUNT(*) FROM orders"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to count orders in DB"})
+		return
+	}
 
 	// Get rows of orders from DB
-	rows, err := db.Query("SELECT * FROM orders")
+	rows, err := db.Query(selectOrderSQL+where+page.limitClause(), args...)
 	// if err from getting rows of orders from DB, return HTTP Bad Request 400
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve orders from DB"})
@@ -644,32 +1057,7 @@ func getOrders(c *gin.Context) {
 	for rows.Next() {
 		var currentOrder order
 		// scan each row of order and save to currentOrder
-		if err := rows.Scan(
-			&currentOrder.OrderId,
-			&currentOrder.AccountId,
-			&currentOrder.OrderLength,
-			&currentOrder.OrderWidth,
-			&currentOrder.OrderHeight,
-			&currentOrder.OrderWeight,
-			&currentOrder.ConsigneeName,
-			&currentOrder.ConsigneeNumber,
-			&currentOrder.ConsigneeCountry,
-			&currentOrder.ConsigneeAddress,
-			&currentOrder.ConsigneePostal,
-			&currentOrder.ConsigneeState,
-			&currentOrder.ConsigneeCity,
-			&currentOrder.ConsigneeProvince,
-			&currentOrder.ConsigneeEmail,
-			&currentOrder.PickupContactName,
-			&currentOrder.PickupContactNumber,
-			&currentOrder.PickupCountry,
-			&currentOrder.PickupAddress,
-			&currentOrder.PickupPostal,
-			&currentOrder.PickupState,
-			&currentOrder.PickupCity,
-			&currentOrder.PickupProvince,
-			&currentOrder.DueDate,
-			&currentOrder.Completed); err != nil {
+		if err := scanOrder(rows, &currentOrder); err != nil {
 			fmt.Println(err.Error())
 			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save orders from DB"})
 			return
@@ -677,12 +1065,17 @@ func getOrders(c *gin.Context) {
 		// add currentOrder to orders slice
 		orders = append(orders, currentOrder)
 	}
+	if err := localiseOrders(orders); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve region timezones from DB"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved orders from DB", "orders": orders})
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved orders from DB", "orders": orders, "total": total, "page": page.Page, "pageSize": page.PageSize})
 }
 
 func updateOrderStatus(c *gin.Context) {
-	var reqBody orderIdCompleted
+	var reqBody orderIdStatus
+	currentUser := c.MustGet("user").(user)
 
 	// Returns Error HTTP Bad Request 400 if unable to read from request body
 	if c.BindJSON(&reqBody) != nil {
@@ -690,20 +1083,51 @@ func updateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// Find order based on Order ID and update status
-	rows, err := db.Query("UPDATE orders SET completed=? WHERE order_id=?", reqBody.Completed, reqBody.OrderId)
-	// if err in updating order, return HTTP Bad Request 400
+	// Find order based on Order ID; reject the change if the client's copy of the order is stale
+	version, ok := readOrderVersion(c, reqBody.OrderId)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
 		return
-	} else if rows != nil {
-		// Respond
-		c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Updated Successfully", "orderUpdated": reqBody.OrderId})
 	}
+	defer tx.Rollback()
+
+	// Cash collected on a cash on delivery order is recorded with its delivery
+	if reqBody.CodCollectedAmount != nil {
+		if reqBody.Status != statusDelivered {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "cod_collected_amount can only be recorded on delivery"})
+			return
+		}
+		if err := recordCODCollectionTx(tx, currentUser, reqBody.OrderId, *reqBody.CodCollectedAmount, version); err != nil {
+			respondOrderChangeError(c, err, "Failed to update orders in database")
+			return
+		}
+	}
+
+	// Check the transition is allowed, update status and append it to the order timeline
+	newVersion, err := changeOrderStatusTx(tx, currentUser, reqBody.OrderId, reqBody.Status, reqBody.Note, reqBody.Location, version)
+	if err != nil {
+		respondOrderChangeError(c, err, "Failed to update orders in database")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+		return
+	}
+
+	// Respond
+	c.Header("ETag", orderETag(newVersion))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Updated Successfully", "orderUpdated": reqBody.OrderId, "orderStatus": reqBody.Status, "version": newVersion})
 }
 
 func assignOrder(c *gin.Context) {
 	var reqBody orderIdAccountId
+	currentUser := c.MustGet("user").(user)
 
 	// Returns Error HTTP Bad Request 400 if unable to read from request body
 	if c.BindJSON(&reqBody) != nil {
@@ -711,14 +1135,32 @@ func assignOrder(c *gin.Context) {
 		return
 	}
 
-	// Find order based on Order ID and update status
-	rows, err := db.Query("UPDATE orders SET account_id=? WHERE order_id=?", reqBody.AccountId, reqBody.OrderId)
-	// if err in updating order, return HTTP Bad Request 400
+	// Find order based on Order ID; reject the assignment if the client's copy of the order is stale
+	version, ok := readOrderVersion(c, reqBody.OrderId)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to assign orders in database"})
 		return
-	} else if rows != nil {
-		// Respond
-		c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Assigned Successfully", "orderUpdated": reqBody.OrderId})
 	}
+	defer tx.Rollback()
+
+	// Check the partner covers the order's region, assign it and append it to the order timeline
+	newVersion, err := assignOrderTx(tx, currentUser, reqBody.OrderId, reqBody.AccountId, reqBody.OrgId, version, "")
+	if err != nil {
+		respondOrderChangeError(c, err, "Failed to assign orders in database")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to assign orders in database"})
+		return
+	}
+
+	// Respond
+	c.Header("ETag", orderETag(newVersion))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Assigned Successfully", "orderUpdated": reqBody.OrderId, "version": newVersion})
 }
@@ -0,0 +1,18 @@
+-- Single-use invitations issued by admins for partner onboarding.
+CREATE TABLE invitations (
+    invite_id INT NOT NULL AUTO_INCREMENT,
+    email varchar(255) NOT NULL,
+    account_type ENUM ('admin','partner_malaysia','partner_indonesia') NOT NULL,
+    token_hash char(64) NOT NULL,
+    created_by INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    PRIMARY KEY (invite_id),
+    UNIQUE KEY uq_invitation_token (token_hash),
+    CONSTRAINT fk_invitation_admin
+        FOREIGN KEY (created_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
@@ -0,0 +1,5 @@
+-- Track whether an account's email has been verified.
+-- Accounts that existed before verification was introduced are treated as verified.
+ALTER TABLE accounts ADD COLUMN email_verified_at TIMESTAMP NULL;
+
+UPDATE accounts SET email_verified_at = NOW() WHERE email_verified_at IS NULL;
@@ -0,0 +1,44 @@
+-- Replace the hard-coded account_type ENUM with roles and partner regions tables.
+CREATE TABLE regions (
+    region_id INT NOT NULL AUTO_INCREMENT,
+    region_code varchar(10) NOT NULL,
+    region_name varchar(255) NOT NULL,
+    PRIMARY KEY (region_id),
+    UNIQUE KEY uq_region_code (region_code)
+);
+
+CREATE TABLE region_countries (
+    region_id INT NOT NULL,
+    country varchar(255) NOT NULL,
+    PRIMARY KEY (region_id, country),
+    FOREIGN KEY (region_id)
+        REFERENCES regions(region_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE roles (
+    role_id INT NOT NULL AUTO_INCREMENT,
+    role_name varchar(64) NOT NULL,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    region_id INT,
+    description varchar(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (role_id),
+    UNIQUE KEY uq_role_name (role_name),
+    FOREIGN KEY (region_id)
+        REFERENCES regions(region_id)
+);
+
+INSERT INTO regions (region_code, region_name) VALUES ('MY', 'Malaysia'), ('ID', 'Indonesia');
+INSERT INTO region_countries (region_id, country) VALUES (1, 'Malaysia'), (1, 'MY'), (2, 'Indonesia'), (2, 'ID');
+INSERT INTO roles (role_name, is_admin, region_id, description) VALUES
+    ('admin', TRUE, NULL, 'GECO administrator'),
+    ('partner_malaysia', FALSE, 1, 'Delivery partner for Malaysia'),
+    ('partner_indonesia', FALSE, 2, 'Delivery partner for Indonesia');
+
+ALTER TABLE accounts MODIFY account_type varchar(64);
+ALTER TABLE accounts ADD CONSTRAINT fk_account_role
+    FOREIGN KEY (account_type) REFERENCES roles(role_name) ON UPDATE CASCADE;
+
+ALTER TABLE invitations MODIFY account_type varchar(64) NOT NULL;
+ALTER TABLE invitations ADD CONSTRAINT fk_invitation_role
+    FOREIGN KEY (account_type) REFERENCES roles(role_name) ON UPDATE CASCADE ON DELETE RESTRICT;
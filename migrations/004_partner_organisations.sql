@@ -0,0 +1,21 @@
+-- Partner organisations owning many user accounts; orders are assigned to an organisation
+-- and optionally to an individual user within it.
+CREATE TABLE organisations (
+    org_id INT NOT NULL AUTO_INCREMENT,
+    org_name varchar(255) NOT NULL,
+    account_type varchar(64) NOT NULL,
+    PRIMARY KEY (org_id),
+    CONSTRAINT fk_organisation_role
+        FOREIGN KEY (account_type)
+        REFERENCES roles(role_name)
+        ON UPDATE CASCADE
+);
+
+ALTER TABLE accounts
+    ADD COLUMN org_id INT,
+    ADD COLUMN org_role ENUM ('org_admin','dispatcher','driver'),
+    ADD CONSTRAINT fk_account_organisation FOREIGN KEY (org_id) REFERENCES organisations(org_id);
+
+ALTER TABLE orders
+    ADD COLUMN org_id INT,
+    ADD CONSTRAINT fk_order_organisation FOREIGN KEY (org_id) REFERENCES organisations(org_id);
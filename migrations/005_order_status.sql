@@ -0,0 +1,11 @@
+-- Replace the bare orders.completed integer with an explicit lifecycle status.
+ALTER TABLE orders ADD COLUMN status ENUM ('pending','assigned','accepted','picked_up','in_transit','out_for_delivery','delivered','failed_attempt','returned','cancelled') NOT NULL DEFAULT 'pending';
+
+-- completed != 0 meant delivered; otherwise orders with an account were assigned
+UPDATE orders SET status = CASE
+    WHEN completed <> 0 THEN 'delivered'
+    WHEN account_id IS NOT NULL OR org_id IS NOT NULL THEN 'assigned'
+    ELSE 'pending'
+END;
+
+ALTER TABLE orders DROP COLUMN completed;
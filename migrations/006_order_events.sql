@@ -0,0 +1,20 @@
+-- Append-only timeline of order status changes and assignments.
+CREATE TABLE order_events (
+    event_id INT NOT NULL AUTO_INCREMENT,
+    order_id INT NOT NULL,
+    actor_account_id INT,
+    event_type ENUM ('status','assignment') NOT NULL,
+    old_value varchar(255) NOT NULL DEFAULT '',
+    new_value varchar(255) NOT NULL DEFAULT '',
+    note text NOT NULL,
+    location varchar(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id),
+    KEY idx_order_events_order (order_id, created_at),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (actor_account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
@@ -0,0 +1,7 @@
+-- Orders can be edited (recorded as 'update' events) and cancelled with a reason.
+ALTER TABLE orders ADD COLUMN cancel_reason varchar(255);
+
+ALTER TABLE order_events
+    MODIFY event_type ENUM ('status','assignment','update') NOT NULL,
+    MODIFY old_value text NOT NULL,
+    MODIFY new_value text NOT NULL;
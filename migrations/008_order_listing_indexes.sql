@@ -0,0 +1,9 @@
+-- Creation date and indexes backing GET /orders filtering and sorting.
+-- Existing orders get the migration time as their creation date.
+ALTER TABLE orders
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD KEY idx_orders_status_due_date (status, due_date),
+    ADD KEY idx_orders_due_date (due_date),
+    ADD KEY idx_orders_created_at (created_at),
+    ADD KEY idx_orders_consignee_country (consignee_country),
+    ADD KEY idx_orders_pickup_country (pickup_country);
@@ -0,0 +1,2 @@
+-- FULLTEXT index backing GET /orders/search; column list must match orderSearchColumns.
+ALTER TABLE orders ADD FULLTEXT KEY ft_orders_search (consignee_name, consignee_number, consignee_email, consignee_address, consignee_postal, pickup_contact_name, pickup_contact_number, pickup_address, pickup_postal);
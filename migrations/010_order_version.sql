@@ -0,0 +1,2 @@
+-- Version counter for optimistic concurrency on order mutations (ETag / If-Match).
+ALTER TABLE orders ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,23 @@
+-- Ordered rules assigning new and imported orders to partners; NULL criteria match any order.
+CREATE TABLE assignment_rules (
+    rule_id INT NOT NULL AUTO_INCREMENT,
+    rule_name varchar(255) NOT NULL,
+    priority INT NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    consignee_country varchar(255),
+    consignee_state varchar(255),
+    postal_prefix varchar(10),
+    min_weight INT,
+    max_weight INT,
+    due_within_hours INT,
+    account_id INT,
+    org_id INT,
+    PRIMARY KEY (rule_id),
+    KEY idx_assignment_rules_priority (active, priority),
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,23 @@
+-- Partner capacity for load-balanced auto-assignment; orders no partner has room for are flagged for admins.
+CREATE TABLE partner_capacity (
+    capacity_id INT NOT NULL AUTO_INCREMENT,
+    account_id INT,
+    org_id INT,
+    daily_parcels INT,
+    daily_weight INT,
+    round_robin_weight INT NOT NULL DEFAULT 1,
+    PRIMARY KEY (capacity_id),
+    UNIQUE KEY uq_partner_capacity_account (account_id),
+    UNIQUE KEY uq_partner_capacity_org (org_id),
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE CASCADE
+);
+
+ALTER TABLE assignment_rules
+    ADD COLUMN strategy ENUM ('fixed','least_loaded','weighted_round_robin') NOT NULL DEFAULT 'fixed';
+
+ALTER TABLE orders ADD COLUMN needs_manual_assignment BOOLEAN NOT NULL DEFAULT FALSE;
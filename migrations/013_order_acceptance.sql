@@ -0,0 +1,31 @@
+-- Partners accept or reject assigned orders; unaccepted orders time out back to admins.
+ALTER TABLE orders
+    ADD COLUMN assigned_at TIMESTAMP NULL,
+    ADD KEY idx_orders_status_assigned_at (status, assigned_at);
+
+-- Start the acceptance window of orders already awaiting acceptance now, rather than timing them all out at once
+UPDATE orders SET assigned_at = NOW() WHERE status = 'assigned';
+CREATE TABLE order_rejections (
+    rejection_id INT NOT NULL AUTO_INCREMENT,
+    order_id INT NOT NULL,
+    account_id INT,
+    org_id INT,
+    rejected_by INT,
+    reason varchar(255) NOT NULL,
+    timed_out BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (rejection_id),
+    KEY idx_order_rejections_created_at (created_at),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE SET NULL,
+    FOREIGN KEY (rejected_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
@@ -0,0 +1,2 @@
+-- Postcode/state mismatches found by address validation, NULL when the address checks out.
+ALTER TABLE orders ADD COLUMN address_warning varchar(255);
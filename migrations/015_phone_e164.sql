@@ -0,0 +1,5 @@
+-- Phone numbers normalised to E.164, kept alongside the numbers as typed.
+-- Fill them in for existing orders with: go run . -backfill-phones
+ALTER TABLE orders
+    ADD COLUMN consignee_number_e164 varchar(16),
+    ADD COLUMN pickup_contact_number_e164 varchar(16);
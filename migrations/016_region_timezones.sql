@@ -0,0 +1,6 @@
+-- Display timezone of each region; order due dates are stored in UTC and shown in the consignee's region timezone.
+-- The application now connects with time_zone '+00:00', so TIMESTAMP columns are read and written in UTC.
+ALTER TABLE regions ADD COLUMN timezone varchar(64);
+
+UPDATE regions SET timezone = 'Asia/Kuala_Lumpur' WHERE region_code = 'MY';
+UPDATE regions SET timezone = 'Asia/Jakarta' WHERE region_code = 'ID';
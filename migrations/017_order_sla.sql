@@ -0,0 +1,6 @@
+-- SLA status of open orders, kept up to date by a background job, with timeline events when at risk or breached.
+ALTER TABLE orders
+    ADD COLUMN sla_status ENUM ('on_track','at_risk','breached'),
+    ADD KEY idx_orders_sla_status (sla_status);
+
+ALTER TABLE order_events MODIFY COLUMN event_type ENUM ('status','assignment','update','sla') NOT NULL;
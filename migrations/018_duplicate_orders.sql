@@ -0,0 +1,29 @@
+-- Fingerprint of consignee, address, dimensions and due date used to flag probable duplicate orders for review.
+-- Orders created before this migration have no fingerprint and are not matched.
+-- Orders pulled from the sales channel keep its order id, so pulling again skips orders already imported.
+ALTER TABLE orders
+    ADD COLUMN fingerprint char(64),
+    ADD COLUMN sales_order_id INT,
+    ADD KEY idx_orders_fingerprint (fingerprint),
+    ADD UNIQUE KEY uq_orders_sales_order_id (sales_order_id);
+
+CREATE TABLE order_duplicates (
+    duplicate_id INT NOT NULL AUTO_INCREMENT,
+    order_id INT NOT NULL,
+    original_order_id INT NOT NULL,
+    status ENUM ('open','merged','dismissed') NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_by INT,
+    resolved_at TIMESTAMP NULL,
+    PRIMARY KEY (duplicate_id),
+    KEY idx_order_duplicates_status (status),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (original_order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
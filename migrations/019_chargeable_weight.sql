@@ -0,0 +1,11 @@
+-- Volumetric and chargeable weight of orders, in the units set by ORDER_UNITS (cm/kg by default, or in/lb).
+-- Partner roles may set their own volumetric divisor; NULL uses VOLUMETRIC_DIVISOR.
+ALTER TABLE roles ADD COLUMN volumetric_divisor INT;
+
+ALTER TABLE orders
+    ADD COLUMN volumetric_weight decimal(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN chargeable_weight decimal(10,2) NOT NULL DEFAULT 0,
+    ADD KEY idx_orders_chargeable_weight (chargeable_weight);
+
+-- Existing orders are filled in afterwards with go run . -backfill-weights, which applies ORDER_UNITS and each
+-- partner's divisor.
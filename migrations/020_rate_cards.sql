@@ -0,0 +1,59 @@
+-- Partner rate cards priced by zone and weight band with oversize and remote postcode surcharges, and the
+-- delivery cost quoted for each order when it was created.
+CREATE TABLE rate_cards (
+    rate_card_id INT NOT NULL AUTO_INCREMENT,
+    role_id INT NOT NULL,
+    currency char(3) NOT NULL,
+    oversize_length INT NOT NULL DEFAULT 0,
+    oversize_weight INT NOT NULL DEFAULT 0,
+    oversize_surcharge decimal(10,2) NOT NULL DEFAULT 0,
+    remote_surcharge decimal(10,2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (rate_card_id),
+    UNIQUE KEY uq_rate_cards_role (role_id),
+    FOREIGN KEY (role_id)
+        REFERENCES roles(role_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE rate_card_zones (
+    zone_id INT NOT NULL AUTO_INCREMENT,
+    rate_card_id INT NOT NULL,
+    zone_name varchar(64) NOT NULL,
+    origin_country varchar(255),
+    consignee_country varchar(255) NOT NULL,
+    consignee_state varchar(255),
+    PRIMARY KEY (zone_id),
+    FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE rate_card_bands (
+    band_id INT NOT NULL AUTO_INCREMENT,
+    rate_card_id INT NOT NULL,
+    zone_name varchar(64) NOT NULL,
+    max_weight decimal(10,2) NOT NULL,
+    price decimal(10,2) NOT NULL,
+    PRIMARY KEY (band_id),
+    FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE rate_card_remote_postcodes (
+    rate_card_id INT NOT NULL,
+    postal_prefix varchar(10) NOT NULL,
+    PRIMARY KEY (rate_card_id, postal_prefix),
+    FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE CASCADE
+);
+
+ALTER TABLE orders
+    ADD COLUMN shipping_cost decimal(10,2),
+    ADD COLUMN shipping_currency char(3),
+    ADD COLUMN rate_card_id INT,
+    ADD CONSTRAINT fk_order_rate_card
+        FOREIGN KEY (rate_card_id)
+        REFERENCES rate_cards(rate_card_id)
+        ON DELETE SET NULL;
@@ -0,0 +1,27 @@
+-- Exchange rates maintained by admins or imported from CSV, and per-order snapshots so historical totals do not
+-- drift. Orders without a snapshotted rate for a currency, e.g. created before the rate was set, list it in
+-- missing_rates instead of being converted.
+CREATE TABLE exchange_rates (
+    currency char(3) NOT NULL,
+    base_currency char(3) NOT NULL,
+    rate decimal(18,8) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_by INT,
+    PRIMARY KEY (currency, base_currency),
+    FOREIGN KEY (updated_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
+
+-- Rates an order's totals are converted at, fixed when the order is created
+CREATE TABLE order_exchange_rates (
+    order_id INT NOT NULL,
+    currency char(3) NOT NULL,
+    base_currency char(3) NOT NULL,
+    rate decimal(18,8) NOT NULL,
+    captured_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (order_id, currency, base_currency),
+    FOREIGN KEY (order_id)
+        REFERENCES orders(order_id)
+        ON DELETE CASCADE
+);
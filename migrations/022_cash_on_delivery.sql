@@ -0,0 +1,37 @@
+-- Cash on delivery amounts on orders, the amount partners collected on delivery, and remittances for reconciliation.
+-- Remittances are kept as financial records, so a partner account or organisation with remittances cannot be deleted.
+ALTER TABLE orders
+    ADD COLUMN cod_amount decimal(12,2),
+    ADD COLUMN cod_currency char(3),
+    ADD COLUMN cod_collected_amount decimal(12,2),
+    ADD COLUMN cod_collected_at TIMESTAMP NULL,
+    ADD COLUMN cod_collected_by INT,
+    ADD COLUMN cod_discrepancy BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD KEY idx_orders_cod_collected_at (cod_collected_at),
+    ADD CONSTRAINT fk_order_cod_collected_by
+        FOREIGN KEY (cod_collected_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL;
+
+CREATE TABLE cod_remittances (
+    remittance_id INT NOT NULL AUTO_INCREMENT,
+    account_id INT,
+    org_id INT,
+    remittance_date DATE NOT NULL,
+    currency char(3) NOT NULL,
+    amount decimal(12,2) NOT NULL,
+    reference varchar(255) NOT NULL DEFAULT '',
+    recorded_by INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (remittance_id),
+    KEY idx_cod_remittances_date (remittance_date),
+    FOREIGN KEY (account_id)
+        REFERENCES accounts(account_id)
+        ON DELETE RESTRICT,
+    FOREIGN KEY (org_id)
+        REFERENCES organisations(org_id)
+        ON DELETE RESTRICT,
+    FOREIGN KEY (recorded_by)
+        REFERENCES accounts(account_id)
+        ON DELETE SET NULL
+);
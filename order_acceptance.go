@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Assigned orders wait for the partner to accept them. Orders rejected by the partner, or not accepted within the
+// acceptance window, go back to pending and are flagged for an admin to reassign.
+
+type orderRejection struct {
+	Reason string `json:"reason"`
+}
+
+type rejectionReport struct {
+	AccountId sql.NullInt64 `json:"account_id"`
+	OrgId     sql.NullInt64 `json:"org_id"`
+	Reason    string        `json:"reason"`
+	TimedOut  bool          `json:"timed_out"`
+	Count     int           `json:"count"`
+}
+
+// acceptanceTimeoutHours is how long a partner has to accept an assigned order, configurable with
+// ORDER_ACCEPTANCE_TIMEOUT_HOURS (default 24)
+func acceptanceTimeoutHours() int {
+	hours, err := strconv.Atoi(os.Getenv("ORDER_ACCEPTANCE_TIMEOUT_HOURS"))
+	if err != nil || hours <= 0 {
+		return 24
+	}
+	return hours
+}
+
+// releaseOrderTx unassigns an order awaiting acceptance, records why and flags it for an admin to reassign
+func releaseOrderTx(tx *sql.Tx, actor user, currentOrder order, reason string, timedOut bool) error {
+	if _, err := tx.Exec("UPDATE orders SET account_id=NULL, org_id=NULL, status=?, assigned_at=NULL, needs_manual_assignment=TRUE, version=version+1 WHERE order_id=?", statusPending, currentOrder.OrderId); err != nil {
+		return err
+	}
+	// Unassigned orders fall back to the default volumetric divisor
+	if err := updateOrderWeights(tx, int64(currentOrder.OrderId)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO order_rejections (order_id, account_id, org_id, rejected_by, reason, timed_out) VALUES (?, ?, ?, ?, ?, ?)", currentOrder.OrderId, currentOrder.AccountId, currentOrder.OrgId, actorID(actor), reason, timedOut); err != nil {
+		return err
+	}
+
+	// Append unassignment and status change to the order timeline
+	if err := recordOrderEvent(tx, orderEvent{OrderId: currentOrder.OrderId, ActorAccountId: actorID(actor), EventType: eventAssignment, OldValue: assignmentValue(currentOrder.OrgId, currentOrder.AccountId), Note: reason}); err != nil {
+		return err
+	}
+	return recordOrderEvent(tx, orderEvent{OrderId: currentOrder.OrderId, ActorAccountId: actorID(actor), EventType: eventStatus, OldValue: currentOrder.Status, NewValue: statusPending, Note: reason})
+}
+
+// rejectOrderTx lets the partner an order is assigned to decline it. It returns the order's new version.
+func rejectOrderTx(tx *sql.Tx, actor user, orderID int, reason string, expectedVersion int) (int, error) {
+	currentOrder, err := lockOrder(tx, orderID, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+	if orderActor(actor, currentOrder) != actorPartner {
+		return 0, newOrderChangeError(http.StatusForbidden, "Only the partner the order is assigned to can reject it")
+	}
+	if currentOrder.Status != statusAssigned {
+		return 0, newOrderChangeError(http.StatusBadRequest, "Order is "+currentOrder.Status+" and can no longer be rejected")
+	}
+
+	if err := releaseOrderTx(tx, actor, currentOrder, reason, false); err != nil {
+		return 0, err
+	}
+	return currentOrder.Version + 1, nil
+}
+
+func acceptOrder(c *gin.Context) {
+	currentUser := c.MustGet("user").(user)
+
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid order id"})
+		return
+	}
+
+	// Reject the change if the client's copy of the order is stale
+	version, ok := readOrderVersion(c, orderID)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Only the assigned partner may move an order from assigned to accepted
+	newVersion, err := changeOrderStatusTx(tx, currentUser, orderID, statusAccepted, "", "", version)
+	if err != nil {
+		respondOrderChangeError(c, err, "Failed to update orders in database")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+		return
+	}
+
+	c.Header("ETag", orderETag(newVersion))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Accepted Successfully", "orderAccepted": orderID, "version": newVersion})
+}
+
+func rejectOrder(c *gin.Context) {
+	var reqBody orderRejection
+	currentUser := c.MustGet("user").(user)
+
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid order id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || strings.TrimSpace(reqBody.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "A reason is required to reject an order"})
+		return
+	}
+
+	// Reject the change if the client's copy of the order is stale
+	version, ok := readOrderVersion(c, orderID)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	newVersion, err := rejectOrderTx(tx, currentUser, orderID, strings.TrimSpace(reqBody.Reason), version)
+	if err != nil {
+		respondOrderChangeError(c, err, "Failed to update orders in database")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+		return
+	}
+
+	c.Header("ETag", orderETag(newVersion))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Rejected Successfully", "orderRejected": orderID, "version": newVersion})
+}
+
+// expireUnacceptedOrders releases orders not accepted within the acceptance window and returns their IDs
+func expireUnacceptedOrders() ([]int, error) {
+	hours := acceptanceTimeoutHours()
+	rows, err := db.Query("SELECT order_id FROM orders WHERE status=? AND assigned_at < DATE_SUB(NOW(), INTERVAL ? HOUR)", statusAssigned, hours)
+	if err != nil {
+		return nil, err
+	}
+	var orderIDs []int
+	for rows.Next() {
+		var orderID int
+		if err := rows.Scan(&orderID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+
+	var expired []int
+	reason := fmt.Sprintf("not accepted within %d hours", hours)
+	for _, orderID := range orderIDs {
+		released, err := expireOrder(orderID, reason, hours)
+		if err != nil {
+			return expired, err
+		}
+		if released {
+			expired = append(expired, orderID)
+		}
+	}
+	return expired, nil
+}
+
+// expireOrder releases one order if it is still waiting for acceptance once locked
+func expireOrder(orderID int, reason string, hours int) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	currentOrder, err := lockOrder(tx, orderID, 0)
+	if err != nil {
+		return false, err
+	}
+
+	// The partner may have accepted it, or an admin reassigned it, since it was selected
+	var stillWaiting bool
+	if err := tx.QueryRow("SELECT status=? AND assigned_at < DATE_SUB(NOW(), INTERVAL ? HOUR) FROM orders WHERE order_id=?", statusAssigned, hours, orderID).Scan(&stillWaiting); err != nil {
+		return false, err
+	}
+	if !stillWaiting {
+		return false, nil
+	}
+
+	// Timeouts have no actor account
+	if err := releaseOrderTx(tx, user{}, currentOrder, reason, true); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// notifyAdminsOfExpiredOrders emails every admin the orders that need reassigning
+func notifyAdminsOfExpiredOrders(orderIDs []int) {
+	rows, err := db.Query("SELECT email FROM accounts JOIN roles ON roles.role_name = accounts.account_type WHERE roles.is_admin = TRUE")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	var ids []string
+	for _, orderID := range orderIDs {
+		ids = append(ids, strconv.Itoa(orderID))
+	}
+	body := fmt.Sprintf("These orders were not accepted by their partner within %d hours and need to be reassigned:\n\n%s\n", acceptanceTimeoutHours(), strings.Join(ids, ", "))
+
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		if err := appMailer.Send(email, "GECO orders awaiting reassignment", body); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
+
+// startAcceptanceTimeoutJob checks for orders past their acceptance window every minute
+func startAcceptanceTimeoutJob() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			expired, err := expireUnacceptedOrders()
+			if err != nil {
+				fmt.Println(err.Error())
+			}
+			if len(expired) > 0 {
+				notifyAdminsOfExpiredOrders(expired)
+			}
+		}
+	}()
+}
+
+// getRejectionReport counts rejections and timeouts per partner and reason, optionally within ?from= and ?to=
+func getRejectionReport(c *gin.Context) {
+	var report []rejectionReport
+	var conditions []string
+	var args []interface{}
+
+	// Date ranges are inclusive of the from date and exclusive of the to date
+	ranges := []struct {
+		param     string
+		condition string
+	}{
+		{"from", "created_at >= ?"},
+		{"to", "created_at < ?"},
+	}
+	for _, dateRange := range ranges {
+		if value := c.Query(dateRange.param); value != "" {
+			date, err := parseDateFilter(dateRange.param, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+				return
+			}
+			conditions = append(conditions, dateRange.condition)
+			args = append(args, date)
+		}
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := db.Query("SELECT account_id, org_id, reason, timed_out, COUNT(*) FROM order_rejections"+where+" GROUP BY account_id, org_id, reason, timed_out ORDER BY COUNT(*) DESC", args...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order rejections from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentRow rejectionReport
+		if err := rows.Scan(&currentRow.AccountId, &currentRow.OrgId, &currentRow.Reason, &currentRow.TimedOut, &currentRow.Count); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save order rejections from DB"})
+			return
+		}
+		report = append(report, currentRow)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved order rejections from DB", "rejections": report})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Upper limit of orders changed by one bulk request
+const maxBulkOrders = 1000
+
+// bulkOrderSelection picks orders either by explicit IDs or by the same filters as GET /orders.
+// With atomic set, nothing is applied unless every order succeeds.
+type bulkOrderSelection struct {
+	OrderIds []int             `json:"order_ids"`
+	Filter   map[string]string `json:"filter"`
+	Atomic   bool              `json:"atomic"`
+}
+
+type bulkAssign struct {
+	bulkOrderSelection
+	AccountId int `json:"account_id"`
+	OrgId     int `json:"org_id"`
+}
+
+type bulkStatus struct {
+	bulkOrderSelection
+	Status   string `json:"status"`
+	Note     string `json:"note"`
+	Location string `json:"location"`
+}
+
+type bulkResult struct {
+	OrderId int    `json:"order_id"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Version int    `json:"version,omitempty"`
+}
+
+// resolveBulkOrderIDs returns the IDs of the orders selected by a bulk request
+func resolveBulkOrderIDs(selection bulkOrderSelection, currentUser user) ([]int, error) {
+	if len(selection.OrderIds) > 0 && len(selection.Filter) > 0 {
+		return nil, errors.New("give either order_ids or filter, not both")
+	}
+	if len(selection.OrderIds) > maxBulkOrders {
+		return nil, fmt.Errorf("at most %d orders can be changed at once", maxBulkOrders)
+	}
+	if len(selection.OrderIds) > 0 {
+		return selection.OrderIds, nil
+	}
+	if len(selection.Filter) == 0 {
+		return nil, errors.New("order_ids or filter is required")
+	}
+
+	params := url.Values{}
+	for key, value := range selection.Filter {
+		params.Set(key, value)
+	}
+	where, args, err := buildOrderFilter(params, currentUser)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT orders.order_id FROM orders%s ORDER BY orders.order_id LIMIT %d", where, maxBulkOrders+1), args...)
+	if err != nil {
+		return nil, errors.New("failed to retrieve orders from DB")
+	}
+	defer rows.Close()
+
+	var orderIDs []int
+	for rows.Next() {
+		var orderID int
+		if err := rows.Scan(&orderID); err != nil {
+			return nil, errors.New("failed to retrieve orders from DB")
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	if len(orderIDs) > maxBulkOrders {
+		return nil, fmt.Errorf("filter matches more than %d orders, narrow it down", maxBulkOrders)
+	}
+	return orderIDs, nil
+}
+
+// applyBulkOrderChange runs change for every order in one transaction. Each order runs inside a savepoint so a
+// failing order is rolled back on its own and reported, while the others are kept (unless atomic).
+func applyBulkOrderChange(c *gin.Context, orderIDs []int, atomic bool, change func(tx *sql.Tx, orderID int) (int, error)) {
+	var results []bulkResult
+	failed := 0
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	for _, orderID := range orderIDs {
+		if _, err := tx.Exec("SAVEPOINT bulk_order"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+			return
+		}
+
+		version, err := change(tx, orderID)
+		if err != nil {
+			if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT bulk_order"); rollbackErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+				return
+			}
+
+			message := "Failed to update order in database"
+			var changeErr *orderChangeError
+			if errors.As(err, &changeErr) {
+				message = changeErr.message
+			}
+			results = append(results, bulkResult{OrderId: orderID, Success: false, Message: message})
+			failed++
+			continue
+		}
+		results = append(results, bulkResult{OrderId: orderID, Success: true, Version: version})
+	}
+
+	if atomic && failed > 0 {
+		// Deferred rollback discards every change
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"status": http.StatusUnprocessableEntity, "message": "No orders were changed because some orders failed validation", "applied": false, "succeeded": 0, "failed": failed, "results": results})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update orders in database"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Bulk Update Completed", "applied": true, "succeeded": len(orderIDs) - failed, "failed": failed, "results": results})
+}
+
+func bulkAssignOrders(c *gin.Context) {
+	var reqBody bulkAssign
+	currentUser := c.MustGet("user").(user)
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	orderIDs, err := resolveBulkOrderIDs(reqBody.bulkOrderSelection, currentUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+
+	applyBulkOrderChange(c, orderIDs, reqBody.Atomic, func(tx *sql.Tx, orderID int) (int, error) {
+		return assignOrderTx(tx, currentUser, orderID, reqBody.AccountId, reqBody.OrgId, 0, "")
+	})
+}
+
+func bulkUpdateOrderStatus(c *gin.Context) {
+	var reqBody bulkStatus
+	currentUser := c.MustGet("user").(user)
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	if !isValidOrderStatus(reqBody.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "A valid status is required"})
+		return
+	}
+
+	orderIDs, err := resolveBulkOrderIDs(reqBody.bulkOrderSelection, currentUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+
+	applyBulkOrderChange(c, orderIDs, reqBody.Atomic, func(tx *sql.Tx, orderID int) (int, error) {
+		return changeOrderStatusTx(tx, currentUser, orderID, reqBody.Status, reqBody.Note, reqBody.Location, 0)
+	})
+}
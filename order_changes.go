@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orderChangeError is a user facing reason an order change was refused, with the HTTP status to respond with
+type orderChangeError struct {
+	httpStatus int
+	message    string
+}
+
+func (e *orderChangeError) Error() string {
+	return e.message
+}
+
+func newOrderChangeError(httpStatus int, message string) error {
+	return &orderChangeError{httpStatus: httpStatus, message: message}
+}
+
+var errOrderNotFound = newOrderChangeError(http.StatusNotFound, "No order found")
+var errStaleOrder = newOrderChangeError(http.StatusConflict, "Order has been changed by someone else, please reload")
+
+// respondOrderChangeError responds with the status of an orderChangeError, or 400 for database failures
+func respondOrderChangeError(c *gin.Context, err error, fallbackMessage string) {
+	var changeErr *orderChangeError
+	if errors.As(err, &changeErr) {
+		c.JSON(changeErr.httpStatus, gin.H{"status": changeErr.httpStatus, "message": changeErr.message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": fallbackMessage})
+}
+
+// lockOrder reads an order for update within tx; expectedVersion 0 skips the staleness check
+func lockOrder(tx *sql.Tx, orderID int, expectedVersion int) (order, error) {
+	var currentOrder order
+	if err := scanOrder(tx.QueryRow(selectOrderSQL+" WHERE orders.order_id=? FOR UPDATE", orderID), &currentOrder); err != nil {
+		if err == sql.ErrNoRows {
+			return currentOrder, errOrderNotFound
+		}
+		return currentOrder, err
+	}
+	if expectedVersion != 0 && currentOrder.Version != expectedVersion {
+		return currentOrder, errStaleOrder
+	}
+	return currentOrder, nil
+}
+
+// changeOrderStatusTx moves an order along its lifecycle on behalf of actor and records it in the timeline.
+// It returns the order's new version.
+func changeOrderStatusTx(tx *sql.Tx, actor user, orderID int, status string, note string, location string, expectedVersion int) (int, error) {
+	currentOrder, err := lockOrder(tx, orderID, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check the transition is in the order lifecycle and the user may perform it
+	if err := checkOrderTransition(currentOrder.Status, status, orderActor(actor, currentOrder)); err != nil {
+		if err == errTransitionForbidden {
+			return 0, newOrderChangeError(http.StatusForbidden, err.Error())
+		}
+		return 0, newOrderChangeError(http.StatusBadRequest, err.Error())
+	}
+
+	// Partners must record the cash they collected when delivering a cash on delivery order
+	if status == statusDelivered && currentOrder.CodAmount.Valid && !currentOrder.CodCollectedAmount.Valid {
+		return 0, newOrderChangeError(http.StatusBadRequest, "Cash on delivery orders must be delivered with cod_collected_amount")
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET status=?, version=version+1 WHERE order_id=?", status, orderID); err != nil {
+		return 0, err
+	}
+
+	// Append status change to the order timeline
+	if err := recordOrderEvent(tx, orderEvent{OrderId: orderID, ActorAccountId: actorID(actor), EventType: eventStatus, OldValue: currentOrder.Status, NewValue: status, Note: note, Location: location}); err != nil {
+		return 0, err
+	}
+
+	return currentOrder.Version + 1, nil
+}
+
+// resolveAssignmentTarget checks a partner can take an order and returns the organisation and account it is assigned
+// to. An order is assigned to an organisation, and optionally to an individual user within it. It does not write,
+// so dry runs of assignment rules can use it.
+func resolveAssignmentTarget(q queryer, o order, accountID int, orgID int) (newOrgID sql.NullInt64, newAccountID sql.NullInt64, err error) {
+	if accountID != 0 {
+		covered, err := accountCoversCountry(accountID, o.ConsigneeCountry)
+		if err != nil {
+			return newOrgID, newAccountID, err
+		}
+		if !covered {
+			return newOrgID, newAccountID, newOrderChangeError(http.StatusBadRequest, "Account is not a partner covering "+o.ConsigneeCountry)
+		}
+
+		// An account belonging to an organisation assigns the order to that organisation too
+		if err := q.QueryRow("SELECT org_id FROM accounts WHERE account_id=?", accountID).Scan(&newOrgID); err != nil {
+			return newOrgID, newAccountID, err
+		}
+		if orgID != 0 && newOrgID.Int64 != int64(orgID) {
+			return newOrgID, newAccountID, newOrderChangeError(http.StatusBadRequest, "Account does not belong to the organisation")
+		}
+		newAccountID = sql.NullInt64{Int64: int64(accountID), Valid: true}
+	} else if orgID != 0 {
+		covered, err := orgCoversCountry(orgID, o.ConsigneeCountry)
+		if err != nil {
+			return newOrgID, newAccountID, err
+		}
+		if !covered {
+			return newOrgID, newAccountID, newOrderChangeError(http.StatusBadRequest, "Organisation is not a partner covering "+o.ConsigneeCountry)
+		}
+		newOrgID = sql.NullInt64{Int64: int64(orgID), Valid: true}
+	} else {
+		return newOrgID, newAccountID, newOrderChangeError(http.StatusBadRequest, "account_id or org_id is required")
+	}
+	return newOrgID, newAccountID, nil
+}
+
+// assignOrderTx assigns an order to a partner organisation and/or account on behalf of an admin
+// and records it in the timeline with note. It returns the order's new version.
+func assignOrderTx(tx *sql.Tx, actor user, orderID int, accountID int, orgID int, expectedVersion int, note string) (int, error) {
+	currentOrder, err := lockOrder(tx, orderID, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	// Orders can be assigned while pending, or reassigned before the partner accepts them
+	if currentOrder.Status != statusAssigned {
+		if err := checkOrderTransition(currentOrder.Status, statusAssigned, actorAdmin); err != nil {
+			return 0, newOrderChangeError(http.StatusBadRequest, "Order is "+currentOrder.Status+" and can no longer be assigned")
+		}
+	}
+
+	newOrgID, newAccountID, err := resolveAssignmentTarget(tx, currentOrder, accountID, orgID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET account_id=?, org_id=?, status=?, assigned_at=NOW(), needs_manual_assignment=FALSE, version=version+1 WHERE order_id=?", newAccountID, newOrgID, statusAssigned, orderID); err != nil {
+		return 0, err
+	}
+	// The new partner may use a different volumetric divisor
+	if err := updateOrderWeights(tx, int64(orderID)); err != nil {
+		return 0, err
+	}
+
+	// Append assignment, and the status change for a pending order, to the order timeline
+	if err := recordOrderEvent(tx, orderEvent{OrderId: orderID, ActorAccountId: actorID(actor), EventType: eventAssignment, OldValue: assignmentValue(currentOrder.OrgId, currentOrder.AccountId), NewValue: assignmentValue(newOrgID, newAccountID), Note: note}); err != nil {
+		return 0, err
+	}
+	if currentOrder.Status != statusAssigned {
+		if err := recordOrderEvent(tx, orderEvent{OrderId: orderID, ActorAccountId: actorID(actor), EventType: eventStatus, OldValue: currentOrder.Status, NewValue: statusAssigned}); err != nil {
+			return 0, err
+		}
+	}
+
+	return currentOrder.Version + 1, nil
+}
+
+// readOrderVersion returns the current version of an order after checking the required If-Match header against it
+func readOrderVersion(c *gin.Context, orderID int) (int, bool) {
+	var version int
+	if err := db.QueryRow("SELECT version FROM orders WHERE order_id=?", orderID).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No order found"})
+			return 0, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order from database"})
+		return 0, false
+	}
+	return version, requireIfMatch(c) && checkIfMatch(c, version)
+}
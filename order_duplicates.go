@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Review states of a suspected duplicate
+const (
+	duplicateOpen      = "open"
+	duplicateMerged    = "merged"
+	duplicateDismissed = "dismissed"
+)
+
+// orderDuplicate pairs an order with an earlier order it probably duplicates
+type orderDuplicate struct {
+	DuplicateId     int           `json:"duplicate_id"`
+	OrderId         int           `json:"order_id"`
+	OriginalOrderId int           `json:"original_order_id"`
+	Status          string        `json:"status"`
+	CreatedAt       time.Time     `json:"created_at"`
+	ResolvedBy      sql.NullInt64 `json:"resolved_by"`
+	Order           *order        `json:"order,omitempty"`
+	OriginalOrder   *order        `json:"original_order,omitempty"`
+}
+
+// fingerprintText lower-cases a value and keeps only letters and digits, so spacing and punctuation differences
+// between two submissions of the same parcel do not matter
+func fingerprintText(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, value)
+}
+
+// orderFingerprint identifies a parcel by consignee name, phone, address, dimensions and due date.
+// Call it after validateNewOrder so the phone number and due date are normalised.
+func orderFingerprint(o newOrderFromFrontend) string {
+	phone := o.ConsigneeNumberE164
+	if phone == "" {
+		phone = fingerprintText(o.ConsigneeNumber)
+	}
+	parts := []string{
+		fingerprintText(o.ConsigneeName),
+		phone,
+		fingerprintText(o.ConsigneeAddress),
+		fingerprintText(o.ConsigneePostal),
+		fmt.Sprintf("%dx%dx%d/%d", o.OrderLength, o.OrderWidth, o.OrderHeight, o.OrderWeight),
+		o.DueAt.UTC().Format("2006-01-02"),
+	}
+	hash := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(hash[:])
+}
+
+// flagDuplicateOrders queues a newly created order for review against every earlier, uncancelled order with the
+// same fingerprint and returns the IDs of those orders
+func flagDuplicateOrders(orderID int64, fingerprint string) ([]int, error) {
+	rows, err := db.Query("SELECT order_id FROM orders WHERE fingerprint=? AND order_id<? AND status<>? ORDER BY order_id", fingerprint, orderID, statusCancelled)
+	if err != nil {
+		return nil, err
+	}
+	var originalIDs []int
+	for rows.Next() {
+		var originalID int
+		if err := rows.Scan(&originalID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		originalIDs = append(originalIDs, originalID)
+	}
+	rows.Close()
+
+	for _, originalID := range originalIDs {
+		if _, err := db.Exec("INSERT INTO order_duplicates (order_id, original_order_id) VALUES (?, ?)", orderID, originalID); err != nil {
+			return nil, err
+		}
+	}
+	return originalIDs, nil
+}
+
+func getOrderDuplicates(c *gin.Context) {
+	var duplicates []orderDuplicate
+
+	// Open suspected duplicates by default, ?status=merged or dismissed for resolved ones
+	status := c.DefaultQuery("status", duplicateOpen)
+	if status != duplicateOpen && status != duplicateMerged && status != duplicateDismissed {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "status must be one of open, merged, dismissed"})
+		return
+	}
+	page, err := parseOrderPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+
+	rows, err := db.Query("SELECT duplicate_id, order_id, original_order_id, status, created_at, resolved_by FROM order_duplicates WHERE status=? ORDER BY duplicate_id LIMIT ? OFFSET ?", status, page.PageSize, (page.Page-1)*page.PageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve duplicate orders from DB"})
+		return
+	}
+	for rows.Next() {
+		var duplicate orderDuplicate
+		if err := rows.Scan(&duplicate.DuplicateId, &duplicate.OrderId, &duplicate.OriginalOrderId, &duplicate.Status, &duplicate.CreatedAt, &duplicate.ResolvedBy); err != nil {
+			rows.Close()
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save duplicate orders from DB"})
+			return
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+	rows.Close()
+
+	// Include both orders so reviewers can compare them side by side
+	for i := range duplicates {
+		duplicates[i].Order, duplicates[i].OriginalOrder = &order{}, &order{}
+		if err := scanOrder(db.QueryRow(selectOrderSQL+" WHERE orders.order_id=?", duplicates[i].OrderId), duplicates[i].Order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve orders from DB"})
+			return
+		}
+		if err := scanOrder(db.QueryRow(selectOrderSQL+" WHERE orders.order_id=?", duplicates[i].OriginalOrderId), duplicates[i].OriginalOrder); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve orders from DB"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved duplicate orders from DB", "duplicates": duplicates, "page": page.Page, "pageSize": page.PageSize})
+}
+
+// lockOpenDuplicate reads an open suspected duplicate for update, responding 404 or 409 if it cannot be resolved
+func lockOpenDuplicate(c *gin.Context, tx *sql.Tx) (orderDuplicate, bool) {
+	var duplicate orderDuplicate
+
+	duplicateID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid duplicate id"})
+		return duplicate, false
+	}
+
+	if err := tx.QueryRow("SELECT duplicate_id, order_id, original_order_id, status, created_at, resolved_by FROM order_duplicates WHERE duplicate_id=? FOR UPDATE", duplicateID).Scan(&duplicate.DuplicateId, &duplicate.OrderId, &duplicate.OriginalOrderId, &duplicate.Status, &duplicate.CreatedAt, &duplicate.ResolvedBy); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No duplicate found"})
+			return duplicate, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve duplicate from database"})
+		return duplicate, false
+	}
+	if duplicate.Status != duplicateOpen {
+		c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "Duplicate has already been " + duplicate.Status})
+		return duplicate, false
+	}
+	return duplicate, true
+}
+
+// mergeOrderDuplicate cancels the duplicate order, keeping the original's items and copying over only items it lacks
+func mergeOrderDuplicate(c *gin.Context) {
+	currentUser := c.MustGet("user").(user)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to merge orders in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	duplicate, ok := lockOpenDuplicate(c, tx)
+	if !ok {
+		return
+	}
+
+	// Items can only be merged into an original that is still going to be delivered
+	original, err := lockOrder(tx, duplicate.OriginalOrderId, 0)
+	if err != nil {
+		respondOrderChangeError(c, err, "Failed to merge orders in database")
+		return
+	}
+	if original.Status == statusCancelled || original.Status == statusDelivered || original.Status == statusReturned {
+		c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": fmt.Sprintf("Original order %d is %s and can no longer be merged into", original.OrderId, original.Status)})
+		return
+	}
+
+	// Cancelling is a status change, so the lifecycle decides whether the duplicate can still be merged
+	reason := fmt.Sprintf("duplicate of order %d", duplicate.OriginalOrderId)
+	if _, err := changeOrderStatusTx(tx, currentUser, duplicate.OrderId, statusCancelled, reason, "", 0); err != nil {
+		respondOrderChangeError(c, err, "Failed to merge orders in database")
+		return
+	}
+	if _, err := tx.Exec("UPDATE orders SET cancel_reason=? WHERE order_id=?", reason, duplicate.OrderId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to merge orders in database"})
+		return
+	}
+
+	// The original keeps its items; only items it does not have (by product id and SKU) are copied from the duplicate.
+	// Items are linked either directly by items.order_id or through order_items.
+	result, err := tx.Exec("INSERT INTO items (order_id, item_description, item_category, item_product_id, item_sku, item_quantity, item_price_value, item_price_currency) SELECT ?, d.item_description, d.item_category, d.item_product_id, d.item_sku, d.item_quantity, d.item_price_value, d.item_price_currency FROM items d WHERE (d.order_id=? OR d.item_id IN (SELECT item_id FROM order_items WHERE order_id=?)) AND NOT EXISTS (SELECT 1 FROM items o WHERE (o.order_id=? OR o.item_id IN (SELECT item_id FROM order_items WHERE order_id=?)) AND o.item_product_id = d.item_product_id AND o.item_sku = d.item_sku) ORDER BY d.item_id", duplicate.OriginalOrderId, duplicate.OrderId, duplicate.OrderId, duplicate.OriginalOrderId, duplicate.OriginalOrderId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to merge orders in database"})
+		return
+	}
+	itemsCopied, _ := result.RowsAffected()
+
+	// Copied items keep the rates the duplicate was created with for currencies the original has no rate for
+	if _, err := tx.Exec("INSERT IGNORE INTO order_exchange_rates (order_id, currency, base_currency, rate) SELECT ?, currency, base_currency, rate FROM order_exchange_rates WHERE order_id=?", duplicate.OriginalOrderId, duplicate.OrderId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to merge orders in database"})
+		return
+	}
+	if itemsCopied > 0 {
+		if err := recordOrderEvent(tx, orderEvent{OrderId: duplicate.OriginalOrderId, ActorAccountId: actorID(currentUser), EventType: eventUpdate, NewValue: "items", Note: fmt.Sprintf("copied %d items from duplicate order %d", itemsCopied, duplicate.OrderId)}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to record order event"})
+			return
+		}
+	}
+
+	// Other open reviews involving the cancelled order are closed, as there is nothing left to merge
+	if _, err := tx.Exec("UPDATE order_duplicates SET status=?, resolved_by=?, resolved_at=NOW() WHERE status=? AND duplicate_id<>? AND (order_id=? OR original_order_id=?)", duplicateDismissed, currentUser.Account_id, duplicateOpen, duplicate.DuplicateId, duplicate.OrderId, duplicate.OrderId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update duplicate in database"})
+		return
+	}
+
+	if !resolveOrderDuplicate(c, tx, duplicate, duplicateMerged, currentUser) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Duplicate Order Merged Successfully", "orderCancelled": duplicate.OrderId, "mergedInto": duplicate.OriginalOrderId, "itemsCopied": itemsCopied})
+}
+
+// dismissOrderDuplicate marks a suspected duplicate as a genuine separate order
+func dismissOrderDuplicate(c *gin.Context) {
+	currentUser := c.MustGet("user").(user)
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to dismiss duplicate in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	duplicate, ok := lockOpenDuplicate(c, tx)
+	if !ok {
+		return
+	}
+	if !resolveOrderDuplicate(c, tx, duplicate, duplicateDismissed, currentUser) {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Duplicate Dismissed Successfully", "duplicateDismissed": duplicate.DuplicateId})
+}
+
+// resolveOrderDuplicate records the review outcome and commits tx
+func resolveOrderDuplicate(c *gin.Context, tx *sql.Tx, duplicate orderDuplicate, status string, reviewer user) bool {
+	if _, err := tx.Exec("UPDATE order_duplicates SET status=?, resolved_by=?, resolved_at=NOW() WHERE duplicate_id=?", status, reviewer.Account_id, duplicate.DuplicateId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update duplicate in database"})
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update duplicate in database"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of change recorded in an order's timeline
+const (
+	eventStatus     = "status"
+	eventAssignment = "assignment"
+	eventUpdate     = "update"
+	eventSLA        = "sla"
+)
+
+type orderEvent struct {
+	EventId        int            `json:"event_id"`
+	OrderId        int            `json:"order_id"`
+	ActorAccountId sql.NullInt64  `json:"actor_account_id"`
+	ActorEmail     sql.NullString `json:"actor_email"`
+	EventType      string         `json:"event_type"`
+	OldValue       string         `json:"old_value"`
+	NewValue       string         `json:"new_value"`
+	Note           string         `json:"note"`
+	Location       string         `json:"location"`
+	CreatedAt      string         `json:"created_at"`
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx so events can be written inside the same transaction as the change
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func recordOrderEvent(exec execer, event orderEvent) error {
+	_, err := exec.Exec("INSERT INTO order_events (order_id, actor_account_id, event_type, old_value, new_value, note, location) VALUES (?, ?, ?, ?, ?, ?, ?)", event.OrderId, event.ActorAccountId, event.EventType, event.OldValue, event.NewValue, event.Note, event.Location)
+	return err
+}
+
+// assignmentValue describes who an order is assigned to, e.g. "org_id=2,account_id=5"; empty when unassigned
+func assignmentValue(orgID sql.NullInt64, accountID sql.NullInt64) string {
+	var parts []string
+	if orgID.Valid {
+		parts = append(parts, fmt.Sprintf("org_id=%d", orgID.Int64))
+	}
+	if accountID.Valid {
+		parts = append(parts, fmt.Sprintf("account_id=%d", accountID.Int64))
+	}
+	return strings.Join(parts, ",")
+}
+
+// actorID is NULL for automatic changes, which are made by the zero user
+func actorID(u user) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(u.Account_id), Valid: u.Account_id != 0}
+}
+
+func getOrderTimeline(c *gin.Context) {
+	var events []orderEvent
+	var currentOrder order
+	currentUser := c.MustGet("user").(user)
+
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid order id"})
+		return
+	}
+
+	// Only admins and the partner the order is assigned to can see its timeline
+	if err := scanOrder(db.QueryRow(selectOrderSQL+" WHERE orders.order_id=?", orderID), &currentOrder); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No order found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order from database"})
+		return
+	}
+	if orderActor(currentUser, currentOrder) == "" {
+		c.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": "You do not have access to this order"})
+		return
+	}
+
+	rows, err := db.Query("SELECT event_id, order_id, actor_account_id, accounts.email, event_type, old_value, new_value, note, location, created_at FROM order_events LEFT JOIN accounts ON accounts.account_id = order_events.actor_account_id WHERE order_id=? ORDER BY created_at, event_id", orderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order timeline from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event orderEvent
+		if err := rows.Scan(&event.EventId, &event.OrderId, &event.ActorAccountId, &event.ActorEmail, &event.EventType, &event.OldValue, &event.NewValue, &event.Note, &event.Location, &event.CreatedAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save order timeline from DB"})
+			return
+		}
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved order timeline from DB", "orderId": orderID, "timeline": events})
+}
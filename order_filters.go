@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultOrdersPageSize = 50
+const maxOrdersPageSize = 200
+
+// Sort keys accepted by ?sort=, prefix with "-" for descending
+var orderSortColumns = map[string]string{
+	"due_date":          "orders.due_date",
+	"order_id":          "orders.order_id",
+	"created_at":        "orders.created_at",
+	"chargeable_weight": "orders.chargeable_weight",
+}
+
+type orderPage struct {
+	Page     int
+	PageSize int
+	OrderBy  string
+}
+
+// partnerScope restricts non-admin users to orders assigned to them or their organisation
+func partnerScope(currentUser user) (string, []interface{}) {
+	if currentUser.Is_Admin {
+		return "", nil
+	}
+	if currentUser.Org_id.Valid {
+		return "(orders.account_id=? OR orders.org_id=?)", []interface{}{currentUser.Account_id, currentUser.Org_id.Int64}
+	}
+	return "orders.account_id=?", []interface{}{currentUser.Account_id}
+}
+
+// buildOrderFilter translates query string filters into a parameterised WHERE clause (including the leading "WHERE", or empty)
+func buildOrderFilter(params url.Values, currentUser user) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	if scope, scopeArgs := partnerScope(currentUser); scope != "" {
+		conditions = append(conditions, scope)
+		args = append(args, scopeArgs...)
+	}
+
+	// ?status=pending,assigned
+	if value := params.Get("status"); value != "" {
+		statuses := strings.Split(value, ",")
+		for _, status := range statuses {
+			if !isValidOrderStatus(status) {
+				return "", nil, fmt.Errorf("unknown order status %q", status)
+			}
+			args = append(args, status)
+		}
+		conditions = append(conditions, "orders.status IN (?"+strings.Repeat(", ?", len(statuses)-1)+")")
+	}
+
+	// ?sla_status=at_risk,breached
+	if value := params.Get("sla_status"); value != "" {
+		slaStatuses := strings.Split(value, ",")
+		for _, slaStatus := range slaStatuses {
+			if !isValidSLAStatus(slaStatus) {
+				return "", nil, fmt.Errorf("unknown SLA status %q", slaStatus)
+			}
+			args = append(args, slaStatus)
+		}
+		conditions = append(conditions, "orders.sla_status IN (?"+strings.Repeat(", ?", len(slaStatuses)-1)+")")
+	}
+
+	// ?account_id=5, or ?account_id=none for unassigned orders
+	if value := params.Get("account_id"); value != "" {
+		if value == "none" {
+			conditions = append(conditions, "orders.account_id IS NULL")
+		} else {
+			accountID, err := strconv.Atoi(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("account_id must be a number or none")
+			}
+			conditions = append(conditions, "orders.account_id=?")
+			args = append(args, accountID)
+		}
+	}
+
+	if value := params.Get("org_id"); value != "" {
+		orgID, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("org_id must be a number")
+		}
+		conditions = append(conditions, "orders.org_id=?")
+		args = append(args, orgID)
+	}
+
+	// ?needs_manual_assignment=true for orders auto-assignment could not place
+	if value := params.Get("needs_manual_assignment"); value != "" {
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("needs_manual_assignment must be true or false")
+		}
+		conditions = append(conditions, "orders.needs_manual_assignment=?")
+		args = append(args, flag)
+	}
+
+	// ?address_flagged=true for orders whose postcode does not match their state
+	if value := params.Get("address_flagged"); value != "" {
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("address_flagged must be true or false")
+		}
+		if flag {
+			conditions = append(conditions, "orders.address_warning IS NOT NULL")
+		} else {
+			conditions = append(conditions, "orders.address_warning IS NULL")
+		}
+	}
+
+	// ?cod=true for cash on delivery orders, ?cod_discrepancy=true for those collected with a different amount
+	if value := params.Get("cod"); value != "" {
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("cod must be true or false")
+		}
+		if flag {
+			conditions = append(conditions, "orders.cod_amount IS NOT NULL")
+		} else {
+			conditions = append(conditions, "orders.cod_amount IS NULL")
+		}
+	}
+	if value := params.Get("cod_discrepancy"); value != "" {
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("cod_discrepancy must be true or false")
+		}
+		conditions = append(conditions, "orders.cod_discrepancy=?")
+		args = append(args, flag)
+	}
+
+	if value := params.Get("consignee_country"); value != "" {
+		conditions = append(conditions, "orders.consignee_country=?")
+		args = append(args, value)
+	}
+
+	if value := params.Get("pickup_country"); value != "" {
+		conditions = append(conditions, "orders.pickup_country=?")
+		args = append(args, value)
+	}
+
+	// Weight ranges are inclusive, in the configured weight unit
+	weightRanges := []struct {
+		param     string
+		condition string
+	}{
+		{"min_chargeable_weight", "orders.chargeable_weight >= ?"},
+		{"max_chargeable_weight", "orders.chargeable_weight <= ?"},
+		{"min_volumetric_weight", "orders.volumetric_weight >= ?"},
+		{"max_volumetric_weight", "orders.volumetric_weight <= ?"},
+	}
+	for _, weightRange := range weightRanges {
+		if value := params.Get(weightRange.param); value != "" {
+			weight, err := strconv.ParseFloat(value, 64)
+			if err != nil || weight < 0 {
+				return "", nil, fmt.Errorf("%s must be a non-negative number", weightRange.param)
+			}
+			conditions = append(conditions, weightRange.condition)
+			args = append(args, weight)
+		}
+	}
+
+	// Date ranges are inclusive of the from date and exclusive of the to date
+	ranges := []struct {
+		param     string
+		condition string
+	}{
+		{"due_from", "orders.due_date >= ?"},
+		{"due_to", "orders.due_date < ?"},
+		{"created_from", "orders.created_at >= ?"},
+		{"created_to", "orders.created_at < ?"},
+	}
+	for _, dateRange := range ranges {
+		if value := params.Get(dateRange.param); value != "" {
+			date, err := parseDateFilter(dateRange.param, value)
+			if err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, dateRange.condition)
+			args = append(args, date)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// parseOrderPage reads ?page=, ?page_size= and ?sort= with defaults of page 1, 50 orders, sorted by order_id
+func parseOrderPage(c *gin.Context) (orderPage, error) {
+	page := orderPage{Page: 1, PageSize: defaultOrdersPageSize, OrderBy: "orders.order_id ASC"}
+
+	if value := c.Query("page"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return page, fmt.Errorf("page must be a positive number")
+		}
+		page.Page = number
+	}
+
+	if value := c.Query("page_size"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 || number > maxOrdersPageSize {
+			return page, fmt.Errorf("page_size must be between 1 and %d", maxOrdersPageSize)
+		}
+		page.PageSize = number
+	}
+
+	if value := c.Query("sort"); value != "" {
+		direction := "ASC"
+		if strings.HasPrefix(value, "-") {
+			direction = "DESC"
+			value = strings.TrimPrefix(value, "-")
+		}
+		column, found := orderSortColumns[value]
+		if !found {
+			return page, fmt.Errorf("sort must be one of due_date, order_id, created_at, chargeable_weight")
+		}
+		// order_id breaks ties so pages are stable
+		page.OrderBy = column + " " + direction + ", orders.order_id " + direction
+	}
+
+	return page, nil
+}
+
+func (p orderPage) limitClause() string {
+	return fmt.Sprintf(" ORDER BY %s LIMIT %d OFFSET %d", p.OrderBy, p.PageSize, (p.Page-1)*p.PageSize)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Columns covered by the ft_orders_search FULLTEXT index; MATCH() must list exactly these
+const orderSearchColumns = "orders.consignee_name, orders.consignee_number, orders.consignee_email, orders.consignee_address, orders.consignee_postal, orders.pickup_contact_name, orders.pickup_contact_number, orders.pickup_address, orders.pickup_postal"
+
+// searchTerms splits a support query into terms, dropping characters that are operators in boolean full-text mode
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '@' && r != '.' && r != '_'
+	})
+}
+
+// booleanSearchQuery requires every term, matching by prefix so partial phone numbers and postcodes are found
+func booleanSearchQuery(terms []string) string {
+	var parts []string
+	for _, term := range terms {
+		// '@' and '.' split tokens in the index, so quote terms containing them as phrases
+		if strings.ContainsAny(term, "@.") {
+			parts = append(parts, fmt.Sprintf("+\"%s\"", term))
+		} else {
+			parts = append(parts, "+"+term+"*")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// phoneSearchNumbers reads a query that looks like a phone number as E.164, as a national number of each country with
+// reference data or in international format, so numbers are found however they were typed
+func phoneSearchNumbers(query string) []string {
+	var codes []string
+	seen := map[string]bool{}
+	for _, rules := range addressRulesByCountry {
+		if !seen[rules.Code] {
+			seen[rules.Code] = true
+			codes = append(codes, rules.Code)
+		}
+	}
+	sort.Strings(codes)
+
+	var numbers []string
+	found := map[string]bool{}
+	for _, code := range codes {
+		if number, err := normalisePhone(query, code); err == nil && !found[number] {
+			found[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
+
+func searchOrders(c *gin.Context) {
+	var orders []order
+	var total int
+	currentUser := c.MustGet("user").(user)
+
+	terms := searchTerms(c.Query("q"))
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Search query q is required"})
+		return
+	}
+	query := booleanSearchQuery(terms)
+
+	// Other GET /orders filters apply too, including partner scoping
+	where, args, err := buildOrderFilter(c.Request.URL.Query(), currentUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+	page, err := parseOrderPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+
+	match := "MATCH(" + orderSearchColumns + ") AGAINST (? IN BOOLEAN MODE)"
+	args = append(args, query)
+
+	// Phone numbers are also matched on their normalised form
+	if numbers := phoneSearchNumbers(c.Query("q")); len(numbers) > 0 {
+		placeholders := "?" + strings.Repeat(", ?", len(numbers)-1)
+		match = "(" + match + " OR orders.consignee_number_e164 IN (" + placeholders + ") OR orders.pickup_contact_number_e164 IN (" + placeholders + "))"
+		for i := 0; i < 2; i++ {
+			for _, number := range numbers {
+				args = append(args, number)
+			}
+		}
+	}
+	if where == "" {
+		where = " WHERE " + match
+	} else {
+		where += " AND " + match
+	}
+
+	// Rank by relevance unless a sort was requested
+	if c.Query("sort") == "" {
+		page.OrderBy = "MATCH(" + orderSearchColumns + ") AGAINST (? IN BOOLEAN MODE) DESC, orders.order_id DESC"
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM orders"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to count orders in DB"})
+		return
+	}
+
+	queryArgs := args
+	if c.Query("sort") == "" {
+		queryArgs = append(append([]interface{}{}, args...), query)
+	}
+	rows, err := db.Query(selectOrderSQL+where+page.limitClause(), queryArgs...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to search orders in DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentOrder order
+		if err := scanOrder(rows, &currentOrder); err != nil {
+			fmt.Println(err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save orders from DB"})
+			return
+		}
+		orders = append(orders, currentOrder)
+	}
+	if err := localiseOrders(orders); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve region timezones from DB"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully searched orders in DB", "orders": orders, "total": total, "page": page.Page, "pageSize": page.PageSize})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLA status of open orders, recomputed every minute from their due date
+const (
+	slaOnTrack  = "on_track"
+	slaAtRisk   = "at_risk"
+	slaBreached = "breached"
+)
+
+func isValidSLAStatus(status string) bool {
+	return status == slaOnTrack || status == slaAtRisk || status == slaBreached
+}
+
+// Orders in these statuses are finished and keep the SLA status they had when they finished
+var closedOrderStatuses = []string{statusDelivered, statusReturned, statusCancelled}
+
+// slaAtRiskHours is how close to its due date an open order becomes at risk, configurable with
+// SLA_AT_RISK_HOURS (default 24)
+func slaAtRiskHours() int {
+	hours, err := strconv.Atoi(os.Getenv("SLA_AT_RISK_HOURS"))
+	if err != nil || hours <= 0 {
+		return 24
+	}
+	return hours
+}
+
+// updateSLAStatuses recomputes the SLA status of every open order, recording a timeline event for each order
+// that becomes at risk or breached. It returns how many orders changed.
+func updateSLAStatuses() (int, error) {
+	args := []interface{}{slaBreached, slaAtRiskHours(), slaAtRisk, slaOnTrack}
+	for _, status := range closedOrderStatuses {
+		args = append(args, status)
+	}
+	rows, err := db.Query("SELECT order_id, sla_status, new_sla_status FROM (SELECT order_id, sla_status, CASE WHEN due_date < NOW() THEN ? WHEN due_date < DATE_ADD(NOW(), INTERVAL ? HOUR) THEN ? ELSE ? END AS new_sla_status FROM orders WHERE status NOT IN (?"+strings.Repeat(", ?", len(closedOrderStatuses)-1)+")) AS open_orders WHERE NOT (sla_status <=> new_sla_status)", args...)
+	if err != nil {
+		return 0, err
+	}
+	type slaChange struct {
+		orderID   int
+		oldStatus sql.NullString
+		newStatus string
+	}
+	var changes []slaChange
+	for rows.Next() {
+		var change slaChange
+		if err := rows.Scan(&change.orderID, &change.oldStatus, &change.newStatus); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		changes = append(changes, change)
+	}
+	rows.Close()
+
+	for _, change := range changes {
+		if err := changeSLAStatus(change.orderID, change.oldStatus, change.newStatus); err != nil {
+			return 0, err
+		}
+	}
+	return len(changes), nil
+}
+
+// changeSLAStatus saves an order's new SLA status. It is derived data, so the order version is left alone and
+// clients editing the order are not sent a conflict.
+func changeSLAStatus(orderID int, oldStatus sql.NullString, newStatus string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE orders SET sla_status=? WHERE order_id=?", newStatus, orderID); err != nil {
+		return err
+	}
+	if newStatus == slaAtRisk || newStatus == slaBreached {
+		if err := recordOrderEvent(tx, orderEvent{OrderId: orderID, EventType: eventSLA, OldValue: oldStatus.String, NewValue: newStatus}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// startSLAJob keeps SLA statuses up to date, checking every minute
+func startSLAJob() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			if _, err := updateSLAStatuses(); err != nil {
+				fmt.Println(err.Error())
+			}
+		}
+	}()
+}
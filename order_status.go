@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Order lifecycle statuses
+const (
+	statusPending        = "pending"
+	statusAssigned       = "assigned" // awaiting the partner's acceptance
+	statusAccepted       = "accepted"
+	statusPickedUp       = "picked_up"
+	statusInTransit      = "in_transit"
+	statusOutForDelivery = "out_for_delivery"
+	statusDelivered      = "delivered"
+	statusFailedAttempt  = "failed_attempt"
+	statusReturned       = "returned"
+	statusCancelled      = "cancelled"
+)
+
+// Who may perform a transition: GECO admins, or the partner the order is assigned to
+const (
+	actorAdmin   = "admin"
+	actorPartner = "partner"
+)
+
+// orderTransitions is the allowed transition graph; each target status lists the actors allowed to move the order there
+var orderTransitions = map[string]map[string][]string{
+	statusPending: {
+		statusAssigned:  {actorAdmin},
+		statusCancelled: {actorAdmin},
+	},
+	statusAssigned: {
+		statusPending:   {actorAdmin},
+		statusAccepted:  {actorPartner},
+		statusCancelled: {actorAdmin},
+	},
+	statusAccepted: {
+		statusPickedUp:  {actorPartner},
+		statusCancelled: {actorAdmin},
+	},
+	statusPickedUp: {
+		statusInTransit: {actorPartner},
+		statusReturned:  {actorPartner, actorAdmin},
+	},
+	statusInTransit: {
+		statusOutForDelivery: {actorPartner},
+		statusReturned:       {actorPartner, actorAdmin},
+	},
+	statusOutForDelivery: {
+		statusDelivered:     {actorPartner},
+		statusFailedAttempt: {actorPartner},
+	},
+	statusFailedAttempt: {
+		statusOutForDelivery: {actorPartner},
+		statusReturned:       {actorPartner, actorAdmin},
+	},
+	statusDelivered: {},
+	statusReturned:  {},
+	statusCancelled: {},
+}
+
+func isValidOrderStatus(status string) bool {
+	_, found := orderTransitions[status]
+	return found
+}
+
+// allowedNextStatuses lists the statuses an order can move to from its current status
+func allowedNextStatuses(from string) []string {
+	var next []string
+	for _, status := range []string{statusPending, statusAssigned, statusAccepted, statusPickedUp, statusInTransit, statusOutForDelivery, statusDelivered, statusFailedAttempt, statusReturned, statusCancelled} {
+		if _, found := orderTransitions[from][status]; found {
+			next = append(next, status)
+		}
+	}
+	return next
+}
+
+// orderActor returns the actor kind of a user for an order, or "" if the user has no say over it
+func orderActor(u user, o order) string {
+	if u.Is_Admin {
+		return actorAdmin
+	}
+	if o.AccountId.Valid && o.AccountId.Int64 == int64(u.Account_id) {
+		return actorPartner
+	}
+	if u.Org_id.Valid && o.OrgId.Valid && o.OrgId.Int64 == u.Org_id.Int64 {
+		return actorPartner
+	}
+	return ""
+}
+
+// checkOrderTransition validates moving an order to a new status on behalf of an actor.
+// The returned error message is safe to show to users.
+func checkOrderTransition(from string, to string, actor string) error {
+	if !isValidOrderStatus(to) {
+		return fmt.Errorf("unknown order status %q", to)
+	}
+
+	allowedActors, found := orderTransitions[from][to]
+	if !found {
+		next := allowedNextStatuses(from)
+		if len(next) == 0 {
+			return fmt.Errorf("order is %s and can no longer change status", from)
+		}
+		return fmt.Errorf("cannot change order status from %s to %s; allowed: %s", from, to, strings.Join(next, ", "))
+	}
+
+	for _, allowed := range allowedActors {
+		if actor == allowed {
+			return nil
+		}
+	}
+	return errTransitionForbidden
+}
+
+var errTransitionForbidden = errors.New("you are not allowed to perform this status change")
+
+// statusFromSalesCompleted maps the sales channel's completed flag onto the order lifecycle
+func statusFromSalesCompleted(completed int) string {
+	if completed != 0 {
+		return statusDelivered
+	}
+	return statusPending
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldError is one problem with one field of a request body
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type validationErrors []fieldError
+
+func (v *validationErrors) add(field string, message string) {
+	*v = append(*v, fieldError{Field: field, Message: message})
+}
+
+// respondValidationErrors responds 422 with every field that failed validation
+func respondValidationErrors(c *gin.Context, errs validationErrors) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"status": http.StatusUnprocessableEntity, "message": "Order failed validation", "errors": errs})
+}
+
+func (v *validationErrors) requireText(field string, value string, maxLength int) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+	} else if len(value) > maxLength {
+		v.add(field, fmt.Sprintf("must be at most %d characters", maxLength))
+	}
+}
+
+func (v *validationErrors) requireBetween(field string, value int, max int) {
+	if value <= 0 || value > max {
+		v.add(field, fmt.Sprintf("must be a whole number between 1 and %d", max))
+	}
+}
+
+// requirePhone returns the phone number in E.164, read as a national number of country unless it has a country code
+func (v *validationErrors) requirePhone(field string, value string, country string) string {
+	if len(value) > 20 {
+		v.add(field, "must be at most 20 characters")
+		return ""
+	}
+	e164, err := normalisePhone(value, country)
+	if err != nil {
+		v.add(field, "must be a phone number of the order's country or include a country code, e.g. +60123456789")
+		return ""
+	}
+	return e164
+}
+
+func (v *validationErrors) requireEmail(field string, value string) {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		v.add(field, "must be a valid email address")
+	}
+}
+
+// importRejection reports an imported order skipped for failing validation, by its position in the import
+type importRejection struct {
+	Index  int              `json:"index"`
+	Errors validationErrors `json:"errors"`
+}
+
+// validateNewOrder normalises and checks an order from the frontend or an import before it is created, returning
+// field errors and address mismatch warnings. Imported orders may already be past due, so allowPastDueDate skips
+// the future due date rule for them.
+func validateNewOrder(o *newOrderFromFrontend, now time.Time, allowPastDueDate bool) (validationErrors, []string, error) {
+	var errs validationErrors
+	warnings := checkOrderAddresses(o, &errs)
+
+	// Limits on parcel dimensions and weight depend on the configured units
+	units := orderUnits()
+	errs.requireBetween("order_length", o.OrderLength, units.MaxDimension)
+	errs.requireBetween("order_width", o.OrderWidth, units.MaxDimension)
+	errs.requireBetween("order_height", o.OrderHeight, units.MaxDimension)
+	errs.requireBetween("order_weight", o.OrderWeight, units.MaxWeight)
+
+	errs.requireText("consignee_name", o.ConsigneeName, 255)
+	o.ConsigneeNumberE164 = errs.requirePhone("consignee_number", o.ConsigneeNumber, o.ConsigneeCountry)
+	errs.requireText("consignee_country", o.ConsigneeCountry, 255)
+	errs.requireText("consignee_address", o.ConsigneeAddress, 1000)
+	errs.requireText("consignee_postal", o.ConsigneePostal, 10)
+	errs.requireEmail("consignee_email", o.ConsigneeEmail)
+	errs.requireText("pickup_contact_name", o.PickupContactName, 255)
+	o.PickupContactNumberE164 = errs.requirePhone("pickup_contact_number", o.PickupContactNumber, o.PickupCountry)
+	errs.requireText("pickup_country", o.PickupCountry, 255)
+	errs.requireText("pickup_address", o.PickupAddress, 1000)
+	errs.requireText("pickup_postal", o.PickupPostal, 10)
+	errs.validateCOD(o)
+
+	// RFC 3339 timestamp with an offset, stored in UTC
+	dueDate, err := parseDueDate(o.DueDate)
+	if err != nil {
+		errs.add("due_date", "must be an RFC 3339 timestamp with an offset, e.g. 2024-05-01T17:00:00+08:00")
+	} else if !allowPastDueDate && !dueDate.After(now) {
+		errs.add("due_date", "must be in the future")
+	}
+	o.DueAt = dueDate
+
+	// Orders may be created for a partner account covering the consignee country
+	if o.AccountId != 0 {
+		covered, err := accountCoversCountry(o.AccountId, o.ConsigneeCountry)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !covered {
+			errs.add("account_id", "must be an existing partner account covering "+o.ConsigneeCountry)
+		}
+	}
+
+	return errs, warnings, nil
+}
+
+// newOrder converts an order pulled from the sales channel into the same shape as an order from the frontend
+func (o ordersFromSales) newOrder() newOrderFromFrontend {
+	return newOrderFromFrontend{
+		OrderLength:         o.OrderLength,
+		OrderWidth:          o.OrderWidth,
+		OrderHeight:         o.OrderHeight,
+		OrderWeight:         o.OrderWeight,
+		ConsigneeName:       o.ConsigneeName,
+		ConsigneeNumber:     o.ConsigneeNumber,
+		ConsigneeCountry:    o.ConsigneeCountry,
+		ConsigneeAddress:    o.ConsigneeAddress,
+		ConsigneePostal:     o.ConsigneePostal,
+		ConsigneeState:      o.ConsigneeState,
+		ConsigneeCity:       o.ConsigneeCity,
+		ConsigneeProvince:   o.ConsigneeProvince,
+		ConsigneeEmail:      o.ConsigneeEmail,
+		PickupContactName:   o.PickupContactName,
+		PickupContactNumber: o.PickupContactNumber,
+		PickupCountry:       o.PickupCountry,
+		PickupAddress:       o.PickupAddress,
+		PickupPostal:        o.PickupPostal,
+		PickupState:         o.PickupState,
+		PickupCity:          o.PickupCity,
+		PickupProvince:      o.PickupProvince,
+		DueDate:             o.DueDate,
+	}
+}
+
+// forFields keeps the errors on the given fields, e.g. those changed by an order update
+func (v validationErrors) forFields(fields map[string]interface{}) validationErrors {
+	var kept validationErrors
+	for _, fieldErr := range v {
+		if _, found := fields[fieldErr.Field]; found {
+			kept = append(kept, fieldErr)
+		}
+	}
+	return kept
+}
+
+// newOrder converts a stored order back into the shape it was created from, so edits can be validated like a new order
+func (o order) newOrder() newOrderFromFrontend {
+	return newOrderFromFrontend{
+		OrderLength:         o.OrderLength,
+		OrderWidth:          o.OrderWidth,
+		OrderHeight:         o.OrderHeight,
+		OrderWeight:         o.OrderWeight,
+		ConsigneeName:       o.ConsigneeName,
+		ConsigneeNumber:     o.ConsigneeNumber,
+		ConsigneeCountry:    o.ConsigneeCountry,
+		ConsigneeAddress:    o.ConsigneeAddress,
+		ConsigneePostal:     o.ConsigneePostal,
+		ConsigneeState:      o.ConsigneeState,
+		ConsigneeCity:       o.ConsigneeCity,
+		ConsigneeProvince:   o.ConsigneeProvince,
+		ConsigneeEmail:      o.ConsigneeEmail,
+		PickupContactName:   o.PickupContactName,
+		PickupContactNumber: o.PickupContactNumber,
+		PickupCountry:       o.PickupCountry,
+		PickupAddress:       o.PickupAddress,
+		PickupPostal:        o.PickupPostal,
+		PickupState:         o.PickupState,
+		PickupCity:          o.PickupCity,
+		PickupProvince:      o.PickupProvince,
+		DueDate:             o.DueDate.Format(time.RFC3339),
+		CodAmount:           o.CodAmount.Float64,
+		CodCurrency:         o.CodCurrency.String,
+	}
+}
+
+// editableColumnValues are the validated and normalised values of an order's editable columns
+func (o newOrderFromFrontend) editableColumnValues() map[string]interface{} {
+	return map[string]interface{}{
+		"order_length":          o.OrderLength,
+		"order_width":           o.OrderWidth,
+		"order_height":          o.OrderHeight,
+		"order_weight":          o.OrderWeight,
+		"consignee_name":        o.ConsigneeName,
+		"consignee_number":      o.ConsigneeNumber,
+		"consignee_country":     o.ConsigneeCountry,
+		"consignee_address":     o.ConsigneeAddress,
+		"consignee_postal":      o.ConsigneePostal,
+		"consignee_state":       o.ConsigneeState,
+		"consignee_city":        o.ConsigneeCity,
+		"consignee_province":    o.ConsigneeProvince,
+		"consignee_email":       o.ConsigneeEmail,
+		"pickup_contact_name":   o.PickupContactName,
+		"pickup_contact_number": o.PickupContactNumber,
+		"pickup_country":        o.PickupCountry,
+		"pickup_address":        o.PickupAddress,
+		"pickup_postal":         o.PickupPostal,
+		"pickup_state":          o.PickupState,
+		"pickup_city":           o.PickupCity,
+		"pickup_province":       o.PickupProvince,
+		"due_date":              o.DueAt,
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type item struct {
+	ItemId            int    `json:"item_id"`
+	ItemDescription   string `json:"item_description"`
+	ItemCategory      string `json:"item_category"`
+	ItemProductId     string `json:"item_product_id"`
+	ItemSku           string `json:"item_sku"`
+	ItemQuantity      int    `json:"item_quantity"`
+	ItemPriceValue    string `json:"item_price_value"`
+	ItemPriceCurrency string `json:"item_price_currency"`
+}
+
+type cancelReason struct {
+	Reason string `json:"reason"`
+}
+
+// Columns that can be corrected after an order is created, and whether they hold integers
+var editableOrderColumns = map[string]bool{
+	"order_length":          true,
+	"order_width":           true,
+	"order_height":          true,
+	"order_weight":          true,
+	"consignee_name":        false,
+	"consignee_number":      false,
+	"consignee_country":     false,
+	"consignee_address":     false,
+	"consignee_postal":      false,
+	"consignee_state":       false,
+	"consignee_city":        false,
+	"consignee_province":    false,
+	"consignee_email":       false,
+	"pickup_contact_name":   false,
+	"pickup_contact_number": false,
+	"pickup_country":        false,
+	"pickup_address":        false,
+	"pickup_postal":         false,
+	"pickup_state":          false,
+	"pickup_city":           false,
+	"pickup_province":       false,
+	"due_date":              false,
+}
+
+// Orders can only be edited until the partner has picked them up
+var editableOrderStatuses = []string{statusPending, statusAssigned, statusAccepted}
+
+func isEditableOrderStatus(status string) bool {
+	for _, editable := range editableOrderStatuses {
+		if status == editable {
+			return true
+		}
+	}
+	return false
+}
+
+// Changing a country re-checks the phone number and address fields read against it
+var countryDependentColumns = map[string][]string{
+	"consignee_country": {"consignee_number", "consignee_postal", "consignee_state", "consignee_province"},
+	"pickup_country":    {"pickup_contact_number", "pickup_postal", "pickup_state", "pickup_province"},
+}
+
+// changedOrderFields are the fields an update changes, plus those that depend on a changed country
+func changedOrderFields(reqBody map[string]interface{}) map[string]interface{} {
+	changed := map[string]interface{}{}
+	for column, value := range reqBody {
+		changed[column] = value
+		for _, dependent := range countryDependentColumns[column] {
+			changed[dependent] = value
+		}
+	}
+	return changed
+}
+
+// Columns a shipping quote is priced on, so changing any of them reprices the order
+var pricedOrderColumns = []string{"order_length", "order_width", "order_height", "order_weight", "pickup_country", "consignee_country", "consignee_state", "consignee_province", "consignee_postal"}
+
+// orderETag is the entity tag of an order version, e.g. "3"
+func orderETag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// checkIfMatch compares the If-Match header against the order's current version, responding 409 when stale
+func checkIfMatch(c *gin.Context, version int) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == orderETag(version) {
+			return true
+		}
+	}
+
+	c.Header("ETag", orderETag(version))
+	c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "Order has been changed by someone else, please reload", "currentVersion": version})
+	return false
+}
+
+// requireIfMatch responds 428 when a request changing an order does not say which version it was based on
+func requireIfMatch(c *gin.Context) bool {
+	if c.GetHeader("If-Match") == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"status": http.StatusPreconditionRequired, "message": "If-Match header with the order's ETag is required"})
+		return false
+	}
+	return true
+}
+
+// respondStaleOrder is used when a versioned UPDATE matched no rows because the order changed after it was read
+func respondStaleOrder(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "Order has been changed by someone else, please reload"})
+}
+
+// findOrderForUser loads an order and checks the logged in user may see it, responding on failure
+func findOrderForUser(c *gin.Context, orderID int, currentOrder *order) bool {
+	currentUser := c.MustGet("user").(user)
+
+	if err := scanOrder(db.QueryRow(selectOrderSQL+" WHERE orders.order_id=?", orderID), currentOrder); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No order found"})
+			return false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order from database"})
+		return false
+	}
+
+	if orderActor(currentUser, *currentOrder) == "" {
+		c.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": "You do not have access to this order"})
+		return false
+	}
+	return true
+}
+
+func getOrderItems(orderID int) ([]item, error) {
+	var items []item
+
+	// Items are linked either directly by items.order_id or through order_items
+	rows, err := db.Query("SELECT item_id, item_description, item_category, item_product_id, item_sku, item_quantity, item_price_value, item_price_currency FROM items WHERE order_id=? OR item_id IN (SELECT item_id FROM order_items WHERE order_id=?) ORDER BY item_id", orderID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentItem item
+		if err := rows.Scan(&currentItem.ItemId, &currentItem.ItemDescription, &currentItem.ItemCategory, &currentItem.ItemProductId, &currentItem.ItemSku, &currentItem.ItemQuantity, &currentItem.ItemPriceValue, &currentItem.ItemPriceCurrency); err != nil {
+			return nil, err
+		}
+		items = append(items, currentItem)
+	}
+	return items, rows.Err()
+}
+
+func getOrder(c *gin.Context) {
+	var currentOrder order
+
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid order id"})
+		return
+	}
+
+	if !findOrderForUser(c, orderID, &currentOrder) {
+		return
+	}
+
+	items, err := getOrderItems(orderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order items from DB"})
+		return
+	}
+	totals, err := calculateOrderTotals(orderID, items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to calculate order totals"})
+		return
+	}
+	localised := []order{currentOrder}
+	if err := localiseOrders(localised); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve region timezones from DB"})
+		return
+	}
+	currentOrder = localised[0]
+
+	c.Header("ETag", orderETag(currentOrder.Version))
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved order from DB", "order": currentOrder, "items": items, "totals": totals})
+}
+
+func updateOrder(c *gin.Context) {
+	var reqBody map[string]interface{}
+	var currentOrder order
+	currentUser := c.MustGet("user").(user)
+
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid order id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || len(reqBody) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	// Only fields present in the request body are updated
+	var columns []string
+	for column := range reqBody {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		isInt, editable := editableOrderColumns[column]
+		if !editable {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": fmt.Sprintf("Field %s cannot be updated", column)})
+			return
+		}
+
+		if isInt {
+			number, ok := reqBody[column].(float64)
+			if !ok || number != math.Trunc(number) {
+				c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": fmt.Sprintf("Field %s must be an integer", column)})
+				return
+			}
+		} else if _, ok := reqBody[column].(string); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": fmt.Sprintf("Field %s must be a string", column)})
+			return
+		}
+	}
+
+	if !findOrderForUser(c, orderID, &currentOrder) {
+		return
+	}
+	if !requireIfMatch(c) || !checkIfMatch(c, currentOrder.Version) {
+		return
+	}
+	if !isEditableOrderStatus(currentOrder.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Order is " + currentOrder.Status + " and can no longer be edited"})
+		return
+	}
+
+	// The edited order must pass the same rules as a new order; only errors on changed fields are reported, and the
+	// due date only has to be in the future when it is changed
+	edited := currentOrder.newOrder()
+	changes, _ := json.Marshal(reqBody)
+	if err := json.Unmarshal(changes, &edited); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	_, dueDateChanged := reqBody["due_date"]
+	errs, addressWarnings, err := validateNewOrder(&edited, time.Now(), !dueDateChanged)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to validate order"})
+		return
+	}
+
+	// An assigned order may only move to a consignee country its partner covers
+	if _, found := reqBody["consignee_country"]; found && (currentOrder.AccountId.Valid || currentOrder.OrgId.Valid) {
+		var covered bool
+		if currentOrder.AccountId.Valid {
+			covered, err = accountCoversCountry(int(currentOrder.AccountId.Int64), edited.ConsigneeCountry)
+		} else {
+			covered, err = orgCoversCountry(int(currentOrder.OrgId.Int64), edited.ConsigneeCountry)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to validate order"})
+			return
+		}
+		if !covered {
+			errs.add("consignee_country", "is not covered by the partner the order is assigned to, reassign the order first")
+		}
+	}
+
+	checked := changedOrderFields(reqBody)
+	if errs = errs.forFields(checked); len(errs) > 0 {
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	// Changed fields are stored as normalised by validation
+	values := edited.editableColumnValues()
+	var setClauses []string
+	var args []interface{}
+	for _, column := range columns {
+		setClauses = append(setClauses, column+"=?")
+		args = append(args, values[column])
+	}
+
+	// Phone numbers are read in their country, so either changing renormalises the number
+	if _, found := checked["consignee_number"]; found {
+		setClauses = append(setClauses, "consignee_number_e164=?")
+		args = append(args, edited.ConsigneeNumberE164)
+	}
+	if _, found := checked["pickup_contact_number"]; found {
+		setClauses = append(setClauses, "pickup_contact_number_e164=?")
+		args = append(args, edited.PickupContactNumberE164)
+	}
+
+	// Address warnings and the duplicate fingerprint are derived from the whole order
+	setClauses = append(setClauses, "address_warning=?", "fingerprint=?")
+	args = append(args, addressWarning(addressWarnings), orderFingerprint(edited))
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update order in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Order must not have changed (e.g. been picked up) since it was read
+	args = append(args, orderID, currentOrder.Version)
+	result, err := tx.Exec("UPDATE orders SET "+strings.Join(setClauses, ", ")+", version=version+1 WHERE order_id=? AND version=?", args...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update order in database"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		respondStaleOrder(c)
+		return
+	}
+
+	// Dimensions or weight may have changed
+	if err := updateOrderWeights(tx, int64(orderID)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update order in database"})
+		return
+	}
+
+	// The stored shipping cost is repriced when anything it was priced on changes
+	for _, column := range pricedOrderColumns {
+		if _, found := reqBody[column]; found {
+			if _, err := storeOrderShippingCost(tx, int64(orderID)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to price order in database"})
+				return
+			}
+			break
+		}
+	}
+
+	if err := recordOrderEvent(tx, orderEvent{OrderId: orderID, ActorAccountId: actorID(currentUser), EventType: eventUpdate, NewValue: strings.Join(columns, ",")}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to record order event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update order in database"})
+		return
+	}
+
+	// Respond with the updated order
+	if err := scanOrder(db.QueryRow(selectOrderSQL+" WHERE orders.order_id=?", orderID), &currentOrder); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve order from database"})
+		return
+	}
+	c.Header("ETag", orderETag(currentOrder.Version))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Updated Successfully", "orderUpdated": currentOrder})
+}
+
+func cancelOrder(c *gin.Context) {
+	var reqBody cancelReason
+	var currentOrder order
+	currentUser := c.MustGet("user").(user)
+
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid order id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if no cancellation reason given
+	if c.ShouldBindJSON(&reqBody) != nil || strings.TrimSpace(reqBody.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "A cancellation reason is required"})
+		return
+	}
+
+	if !findOrderForUser(c, orderID, &currentOrder) {
+		return
+	}
+	if !requireIfMatch(c) || !checkIfMatch(c, currentOrder.Version) {
+		return
+	}
+
+	// Cancelling is a status change, so the lifecycle decides when and by whom it is allowed
+	if err := checkOrderTransition(currentOrder.Status, statusCancelled, orderActor(currentUser, currentOrder)); err != nil {
+		if err == errTransitionForbidden {
+			c.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error(), "currentStatus": currentOrder.Status})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to cancel order in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Soft delete: the order row is kept with its cancellation reason
+	result, err := tx.Exec("UPDATE orders SET status=?, cancel_reason=?, version=version+1 WHERE order_id=? AND version=?", statusCancelled, reqBody.Reason, orderID, currentOrder.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to cancel order in database"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		respondStaleOrder(c)
+		return
+	}
+
+	if err := recordOrderEvent(tx, orderEvent{OrderId: orderID, ActorAccountId: actorID(currentUser), EventType: eventStatus, OldValue: currentOrder.Status, NewValue: statusCancelled, Note: reqBody.Reason}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to record order event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to cancel order in database"})
+		return
+	}
+
+	c.Header("ETag", orderETag(currentOrder.Version+1))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Cancelled Successfully", "orderCancelled": orderID})
+}
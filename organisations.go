@@ -0,0 +1,454 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles of a user within their partner organisation
+var orgRoles = []string{"org_admin", "dispatcher", "driver"}
+
+type organisation struct {
+	OrgId       int    `json:"org_id"`
+	OrgName     string `json:"org_name"`
+	AccountType string `json:"account_type"`
+	MemberCount int    `json:"member_count"`
+}
+
+type newOrganisation struct {
+	OrgName     string `json:"org_name"`
+	AccountType string `json:"account_type"`
+}
+
+type orgMember struct {
+	AccountId int    `json:"account_id"`
+	Email     string `json:"email"`
+	OrgRole   string `json:"org_role"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type accountIdOrgRole struct {
+	AccountId int    `json:"account_id"`
+	OrgRole   string `json:"org_role"`
+}
+
+type newOrgMember struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	First_name string `json:"first_name"`
+	Last_name  string `json:"last_name"`
+	OrgRole    string `json:"org_role"`
+}
+
+func isValidOrgRole(orgRole string) bool {
+	for _, valid := range orgRoles {
+		if orgRole == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// orgCoversCountry reports whether an organisation's partner role covers the given consignee country
+func orgCoversCountry(orgID int, country string) (bool, error) {
+	var covered bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM organisations JOIN roles ON roles.role_name = organisations.account_type JOIN region_countries ON region_countries.region_id = roles.region_id WHERE organisations.org_id=? AND roles.is_admin = FALSE AND region_countries.country=?", orgID, country).Scan(&covered)
+	return covered, err
+}
+
+func requireOrgAdmin(c *gin.Context) {
+	// Must run after auth, which attaches the logged in user account to the request
+	currentUser, exists := c.Get("user")
+	if !exists || !currentUser.(user).Org_id.Valid || currentUser.(user).Org_Role.String != "org_admin" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden, "message": "Organisation admin access required"})
+		return
+	}
+
+	// Continue
+	c.Next()
+}
+
+func getOrganisations(c *gin.Context) {
+	var organisations []organisation
+
+	rows, err := db.Query("SELECT organisations.org_id, org_name, organisations.account_type, COUNT(accounts.account_id) FROM organisations LEFT JOIN accounts ON accounts.org_id = organisations.org_id GROUP BY organisations.org_id ORDER BY organisations.org_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve organisations from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentOrganisation organisation
+		if err := rows.Scan(&currentOrganisation.OrgId, &currentOrganisation.OrgName, &currentOrganisation.AccountType, &currentOrganisation.MemberCount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save organisations from DB"})
+			return
+		}
+		organisations = append(organisations, currentOrganisation)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved organisations from DB", "organisations": organisations})
+}
+
+func postOrganisation(c *gin.Context) {
+	var reqBody newOrganisation
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || reqBody.OrgName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	// Organisations pass their role on to members, so only partner roles are allowed
+	partner, err := isPartnerRole(reqBody.AccountType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve role from DB"})
+		return
+	}
+	if !partner {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "account_type must be a partner role with a region"})
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO organisations (org_name, account_type) VALUES (?, ?)", reqBody.OrgName, reqBody.AccountType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create organisation"})
+		return
+	}
+	orgID, _ := result.LastInsertId()
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "New Organisation Successfully Created", "orgId": orgID})
+}
+
+// addOrganisationMember lets an admin move an existing partner account without an organisation into one, e.g. to
+// appoint its first org admin
+func addOrganisationMember(c *gin.Context) {
+	var reqBody accountIdOrgRole
+
+	orgID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid organisation id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || !isValidOrgRole(reqBody.OrgRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "account_id and a valid org_role are required"})
+		return
+	}
+
+	// Member accounts take the partner role of their organisation
+	var accountType string
+	if err := db.QueryRow("SELECT account_type FROM organisations WHERE org_id=?", orgID).Scan(&accountType); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No organisation found"})
+		return
+	}
+	if partner, err := isPartnerRole(accountType); err != nil || !partner {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Organisation does not have a partner role"})
+		return
+	}
+
+	// Admins stay outside organisations, and an account belongs to at most one organisation
+	var isAdmin bool
+	var currentOrgID sql.NullInt64
+	if err := db.QueryRow("SELECT COALESCE(roles.is_admin, FALSE), accounts.org_id FROM accounts LEFT JOIN roles ON roles.role_name = accounts.account_type WHERE accounts.account_id=?", reqBody.AccountId).Scan(&isAdmin, &currentOrgID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No account found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve account from DB"})
+		return
+	}
+	if isAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Admin accounts cannot join an organisation"})
+		return
+	}
+	if currentOrgID.Valid && currentOrgID.Int64 != int64(orgID) {
+		c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "Account already belongs to another organisation"})
+		return
+	}
+
+	result, err := db.Exec("UPDATE accounts SET org_id=?, org_role=?, account_type=? WHERE account_id=? AND (org_id IS NULL OR org_id=?)", orgID, reqBody.OrgRole, accountType, reqBody.AccountId, orgID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to add account to organisation"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Account already a member with that role or moved to another organisation"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Account Added To Organisation Successfully", "accountUpdated": reqBody.AccountId})
+}
+
+func getMyOrganisationUsers(c *gin.Context) {
+	var members []orgMember
+	orgAdmin := c.MustGet("user").(user)
+
+	rows, err := db.Query("SELECT accounts.account_id, email, org_role, COALESCE(first_name, ''), COALESCE(last_name, '') FROM accounts LEFT JOIN accounts_details ON accounts_details.account_id = accounts.account_id WHERE org_id=? ORDER BY accounts.account_id", orgAdmin.Org_id.Int64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve organisation users from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var member orgMember
+		if err := rows.Scan(&member.AccountId, &member.Email, &member.OrgRole, &member.FirstName, &member.LastName); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save organisation users from DB"})
+			return
+		}
+		members = append(members, member)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved organisation users from DB", "users": members})
+}
+
+func postMyOrganisationUser(c *gin.Context) {
+	var reqBody newOrgMember
+	orgAdmin := c.MustGet("user").(user)
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	if reqBody.Email == "" || reqBody.Password == "" || reqBody.First_name == "" || reqBody.Last_name == "" || !isValidOrgRole(reqBody.OrgRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Email, password, first_name, last_name and a valid org_role are required"})
+		return
+	}
+
+	// Check if email already taken
+	var existingAccountID int
+	err := db.QueryRow("SELECT account_id FROM accounts WHERE email=?", reqBody.Email).Scan(&existingAccountID)
+	if err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Email taken"})
+		return
+	} else if err != sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to check if email taken in database"})
+		return
+	}
+
+	// Hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(reqBody.Password), 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to hash password"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create user"})
+		return
+	}
+	defer tx.Rollback()
+
+	// New member takes the partner role of the org admin's organisation and starts unverified
+	var accountType string
+	if err := tx.QueryRow("SELECT account_type FROM organisations WHERE org_id=?", orgAdmin.Org_id.Int64).Scan(&accountType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve organisation from DB"})
+		return
+	}
+	if partner, err := isPartnerRole(accountType); err != nil || !partner {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Organisation does not have a partner role"})
+		return
+	}
+	result, err := tx.Exec("INSERT INTO accounts (email, password, account_type, org_id, org_role) VALUES (?, ?, ?, ?, ?)", reqBody.Email, string(hash), accountType, orgAdmin.Org_id.Int64, reqBody.OrgRole)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create user"})
+		return
+	}
+	accountID, _ := result.LastInsertId()
+
+	if _, err = tx.Exec("INSERT INTO accounts_details (account_id, first_name, last_name) VALUES (?, ?, ?)", accountID, reqBody.First_name, reqBody.Last_name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create account details"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create user"})
+		return
+	}
+
+	verificationSent := true
+	if err := sendVerificationEmail(int(accountID), reqBody.Email); err != nil {
+		fmt.Println(err.Error())
+		verificationSent = false
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Organisation User Successfully Created", "newAccountEmailCreated": reqBody.Email, "verificationEmailSent": verificationSent})
+}
+
+func updateMyOrganisationUser(c *gin.Context) {
+	var reqBody accountIdOrgRole
+	orgAdmin := c.MustGet("user").(user)
+
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid account id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || !isValidOrgRole(reqBody.OrgRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "A valid org_role is required"})
+		return
+	}
+
+	// Org admins can't demote themselves, so an organisation always keeps an admin
+	if accountID == orgAdmin.Account_id {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Cannot change your own organisation role"})
+		return
+	}
+
+	result, err := db.Exec("UPDATE accounts SET org_role=? WHERE account_id=? AND org_id=?", reqBody.OrgRole, accountID, orgAdmin.Org_id.Int64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update organisation user in database"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No user in your organisation found or role unchanged"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Organisation User Updated Successfully", "accountUpdated": accountID})
+}
+
+func removeMyOrganisationUser(c *gin.Context) {
+	orgAdmin := c.MustGet("user").(user)
+
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid account id"})
+		return
+	}
+
+	if accountID == orgAdmin.Account_id {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Cannot remove yourself from your organisation"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to remove organisation user"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Orders assigned to the user stay with the organisation but are no longer assigned to the individual
+	rows, err := tx.Query("SELECT order_id FROM orders WHERE account_id=? AND org_id=? FOR UPDATE", accountID, orgAdmin.Org_id.Int64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to unassign orders of organisation user"})
+		return
+	}
+	var orderIDs []int
+	for rows.Next() {
+		var orderID int
+		if err := rows.Scan(&orderID); err != nil {
+			rows.Close()
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to unassign orders of organisation user"})
+			return
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+
+	orgID := orgAdmin.Org_id
+	oldAccountID := sql.NullInt64{Int64: int64(accountID), Valid: true}
+	for _, orderID := range orderIDs {
+		if _, err := tx.Exec("UPDATE orders SET account_id=NULL, version=version+1 WHERE order_id=?", orderID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to unassign orders of organisation user"})
+			return
+		}
+		if err := recordOrderEvent(tx, orderEvent{OrderId: orderID, ActorAccountId: actorID(orgAdmin), EventType: eventAssignment, OldValue: assignmentValue(orgID, oldAccountID), NewValue: assignmentValue(orgID, sql.NullInt64{}), Note: "user removed from organisation"}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to record order event"})
+			return
+		}
+	}
+
+	result, err := tx.Exec("UPDATE accounts SET org_id=NULL, org_role=NULL WHERE account_id=? AND org_id=?", accountID, orgAdmin.Org_id.Int64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to remove organisation user"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No user in your organisation found"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to remove organisation user"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Organisation User Removed Successfully", "accountRemoved": accountID})
+}
+
+// assignMyOrganisationOrder lets an org admin hand an order assigned to their organisation to one of its users
+func assignMyOrganisationOrder(c *gin.Context) {
+	var reqBody orderIdAccountId
+	orgAdmin := c.MustGet("user").(user)
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	var memberOrgID sql.NullInt64
+	if err := db.QueryRow("SELECT org_id FROM accounts WHERE account_id=?", reqBody.AccountId).Scan(&memberOrgID); err != nil || memberOrgID.Int64 != orgAdmin.Org_id.Int64 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Account is not a user in your organisation"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to assign orders in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	currentOrder, err := lockOrder(tx, reqBody.OrderId, 0)
+	if err == errOrderNotFound || (err == nil && currentOrder.OrgId.Int64 != orgAdmin.Org_id.Int64) {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No order assigned to your organisation found"})
+		return
+	}
+	if err != nil {
+		respondOrderChangeError(c, err, "Failed to assign orders in database")
+		return
+	}
+	if !requireIfMatch(c) || !checkIfMatch(c, currentOrder.Version) {
+		return
+	}
+
+	// Orders can be handed to another user until the partner has picked them up
+	if currentOrder.Status != statusAssigned && currentOrder.Status != statusAccepted {
+		respondOrderChangeError(c, newOrderChangeError(http.StatusConflict, "Order is "+currentOrder.Status+" and can no longer be reassigned"), "Failed to assign orders in database")
+		return
+	}
+	oldAccountID, version := currentOrder.AccountId, currentOrder.Version
+
+	newAccountID := sql.NullInt64{Int64: int64(reqBody.AccountId), Valid: true}
+	if _, err := tx.Exec("UPDATE orders SET account_id=?, version=version+1 WHERE order_id=?", newAccountID, reqBody.OrderId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to assign orders in database"})
+		return
+	}
+
+	if err := recordOrderEvent(tx, orderEvent{OrderId: reqBody.OrderId, ActorAccountId: actorID(orgAdmin), EventType: eventAssignment, OldValue: assignmentValue(orgAdmin.Org_id, oldAccountID), NewValue: assignmentValue(orgAdmin.Org_id, newAccountID)}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to record order event"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to assign orders in database"})
+		return
+	}
+
+	c.Header("ETag", orderETag(version+1))
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Order Assigned Successfully", "orderUpdated": reqBody.OrderId, "version": version + 1})
+}
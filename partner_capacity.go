@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ways an assignment rule picks the partner for an order
+const (
+	strategyFixed              = "fixed"
+	strategyLeastLoaded        = "least_loaded"
+	strategyWeightedRoundRobin = "weighted_round_robin"
+)
+
+func isValidAssignmentStrategy(strategy string) bool {
+	return strategy == strategyFixed || strategy == strategyLeastLoaded || strategy == strategyWeightedRoundRobin
+}
+
+// Statuses of orders a partner has been given but not yet finished, which count towards its load
+var openOrderStatuses = []string{statusAssigned, statusAccepted, statusPickedUp, statusInTransit, statusOutForDelivery, statusFailedAttempt}
+
+// partnerCapacity is the daily capacity of a partner account or organisation, with its current load.
+// NULL limits are unlimited. round_robin_weight sets the partner's share of each day's assignments under weighted
+// round-robin. Days are UTC dates.
+type partnerCapacity struct {
+	CapacityId       int           `json:"capacity_id"`
+	AccountId        sql.NullInt64 `json:"account_id"`
+	OrgId            sql.NullInt64 `json:"org_id"`
+	DailyParcels     sql.NullInt64 `json:"daily_parcels"`
+	DailyWeight      sql.NullInt64 `json:"daily_weight"`
+	RoundRobinWeight int           `json:"round_robin_weight"`
+	OpenParcels      int           `json:"open_parcels"`
+	OpenWeight       int           `json:"open_weight"`
+	AssignedToday    int           `json:"assigned_today"`
+}
+
+type partnerCapacityFromFrontend struct {
+	AccountId        *int `json:"account_id"`
+	OrgId            *int `json:"org_id"`
+	DailyParcels     *int `json:"daily_parcels"`
+	DailyWeight      *int `json:"daily_weight"`
+	RoundRobinWeight *int `json:"round_robin_weight"`
+}
+
+const selectPartnerCapacitySQL = "SELECT capacity_id, account_id, org_id, daily_parcels, daily_weight, round_robin_weight FROM partner_capacity"
+
+func scanPartnerCapacity(row rowScanner, capacity *partnerCapacity) error {
+	return row.Scan(&capacity.CapacityId, &capacity.AccountId, &capacity.OrgId, &capacity.DailyParcels, &capacity.DailyWeight, &capacity.RoundRobinWeight)
+}
+
+// loadPartnerLoad fills in the parcels and weight of the partner's open orders, and how many uncancelled orders it
+// was assigned today
+func loadPartnerLoad(q queryer, capacity *partnerCapacity) error {
+	column, partnerID := "account_id", capacity.AccountId.Int64
+	if capacity.OrgId.Valid {
+		column, partnerID = "org_id", capacity.OrgId.Int64
+	}
+	args := []interface{}{partnerID}
+	for _, status := range openOrderStatuses {
+		args = append(args, status)
+	}
+	query := "SELECT COUNT(*), COALESCE(SUM(order_weight), 0) FROM orders WHERE " + column + "=? AND status IN (?" + strings.Repeat(", ?", len(openOrderStatuses)-1) + ")"
+	if err := q.QueryRow(query, args...).Scan(&capacity.OpenParcels, &capacity.OpenWeight); err != nil {
+		return err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	return q.QueryRow("SELECT COUNT(*) FROM orders WHERE "+column+"=? AND assigned_at >= ? AND status<>?", partnerID, today, statusCancelled).Scan(&capacity.AssignedToday)
+}
+
+// hasRoomFor reports whether taking the order keeps the partner within its limits
+func (p partnerCapacity) hasRoomFor(o order) bool {
+	if p.DailyParcels.Valid && int64(p.OpenParcels+1) > p.DailyParcels.Int64 {
+		return false
+	}
+	if p.DailyWeight.Valid && int64(p.OpenWeight+o.OrderWeight) > p.DailyWeight.Int64 {
+		return false
+	}
+	return true
+}
+
+// loadRatio is how full the partner is, as the larger of its parcel and weight utilisation
+func (p partnerCapacity) loadRatio() float64 {
+	ratio := 0.0
+	if p.DailyParcels.Valid && p.DailyParcels.Int64 > 0 {
+		ratio = float64(p.OpenParcels) / float64(p.DailyParcels.Int64)
+	}
+	if p.DailyWeight.Valid && p.DailyWeight.Int64 > 0 {
+		if weightRatio := float64(p.OpenWeight) / float64(p.DailyWeight.Int64); weightRatio > ratio {
+			ratio = weightRatio
+		}
+	}
+	return ratio
+}
+
+func (p partnerCapacity) covers(country string) (bool, error) {
+	if p.OrgId.Valid {
+		return orgCoversCountry(int(p.OrgId.Int64), country)
+	}
+	return accountCoversCountry(int(p.AccountId.Int64), country)
+}
+
+// lockSuffix is appended to capacity queries that must lock the rows they read; dry runs read without locking
+func lockSuffix(lock bool) string {
+	if lock {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// readPartnerCapacity reads the capacity settings of an account or organisation, with its load, locking them when
+// lock is set. Partners without settings have unlimited capacity and are returned as nil.
+func readPartnerCapacity(q queryer, accountID int, orgID int, lock bool) (*partnerCapacity, error) {
+	var capacity partnerCapacity
+	query, partnerID := selectPartnerCapacitySQL+" WHERE account_id=?"+lockSuffix(lock), accountID
+	if accountID == 0 {
+		query, partnerID = selectPartnerCapacitySQL+" WHERE org_id=?"+lockSuffix(lock), orgID
+	}
+	if err := scanPartnerCapacity(q.QueryRow(query, partnerID), &capacity); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := loadPartnerLoad(q, &capacity); err != nil {
+		return nil, err
+	}
+	return &capacity, nil
+}
+
+// pickPartner chooses among partners with capacity settings covering the order's country and with room for it.
+// It returns nil when every candidate is full, so the order overflows to manual handling.
+func pickPartner(q queryer, strategy string, o order, lock bool) (*partnerCapacity, error) {
+	// Locking every capacity row serialises concurrent auto-assignments so limits are not overshot
+	rows, err := q.Query(selectPartnerCapacitySQL + " ORDER BY capacity_id" + lockSuffix(lock))
+	if err != nil {
+		return nil, err
+	}
+	var capacities []partnerCapacity
+	for rows.Next() {
+		var capacity partnerCapacity
+		if err := scanPartnerCapacity(rows, &capacity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		capacities = append(capacities, capacity)
+	}
+	rows.Close()
+
+	var best *partnerCapacity
+	for i := range capacities {
+		candidate := &capacities[i]
+		covered, err := candidate.covers(o.ConsigneeCountry)
+		if err != nil {
+			return nil, err
+		}
+		if !covered {
+			continue
+		}
+		if err := loadPartnerLoad(q, candidate); err != nil {
+			return nil, err
+		}
+		if !candidate.hasRoomFor(o) {
+			continue
+		}
+
+		switch strategy {
+		case strategyLeastLoaded:
+			if best == nil || candidate.loadRatio() < best.loadRatio() {
+				best = candidate
+			}
+		case strategyWeightedRoundRobin:
+			// The partner furthest behind its share of today's assignments goes next
+			if candidate.RoundRobinWeight <= 0 {
+				continue
+			}
+			if best == nil || candidate.AssignedToday*best.RoundRobinWeight < best.AssignedToday*candidate.RoundRobinWeight {
+				best = candidate
+			}
+		}
+	}
+	return best, nil
+}
+
+// flagOrderOverflow marks an order no matching assignment rule could assign, so an admin assigns it manually
+func flagOrderOverflow(tx *sql.Tx, o order, reason string) error {
+	if _, err := tx.Exec("UPDATE orders SET needs_manual_assignment=TRUE, version=version+1 WHERE order_id=?", o.OrderId); err != nil {
+		return err
+	}
+	return recordOrderEvent(tx, orderEvent{OrderId: o.OrderId, EventType: eventUpdate, NewValue: "needs_manual_assignment", Note: reason})
+}
+
+func getPartnerCapacities(c *gin.Context) {
+	var capacities []partnerCapacity
+
+	rows, err := db.Query(selectPartnerCapacitySQL + " ORDER BY capacity_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve partner capacity from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentCapacity partnerCapacity
+		if err := scanPartnerCapacity(rows, &currentCapacity); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save partner capacity from DB"})
+			return
+		}
+		capacities = append(capacities, currentCapacity)
+	}
+	rows.Close()
+
+	// Load from open orders and today's assignments
+	for i := range capacities {
+		if err := loadPartnerLoad(db, &capacities[i]); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve partner load from DB"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved partner capacity from DB", "capacities": capacities})
+}
+
+// putPartnerCapacity creates or replaces the capacity settings of one partner account or organisation
+func putPartnerCapacity(c *gin.Context) {
+	var reqBody partnerCapacityFromFrontend
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if (reqBody.AccountId == nil) == (reqBody.OrgId == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Exactly one of account_id or org_id is required"})
+		return
+	}
+	if (reqBody.DailyParcels != nil && *reqBody.DailyParcels < 0) || (reqBody.DailyWeight != nil && *reqBody.DailyWeight < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "daily_parcels and daily_weight must not be negative"})
+		return
+	}
+	roundRobinWeight := 1
+	if reqBody.RoundRobinWeight != nil {
+		if *reqBody.RoundRobinWeight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "round_robin_weight must not be negative"})
+			return
+		}
+		roundRobinWeight = *reqBody.RoundRobinWeight
+	}
+
+	// Unique keys on account_id and org_id turn a second save for the same partner into an update
+	_, err := db.Exec("INSERT INTO partner_capacity (account_id, org_id, daily_parcels, daily_weight, round_robin_weight) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE daily_parcels=VALUES(daily_parcels), daily_weight=VALUES(daily_weight), round_robin_weight=VALUES(round_robin_weight)", reqBody.AccountId, reqBody.OrgId, reqBody.DailyParcels, reqBody.DailyWeight, roundRobinWeight)
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save partner capacity, account or organisation may not exist"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Partner Capacity Saved Successfully"})
+}
+
+func deletePartnerCapacity(c *gin.Context) {
+	capacityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid capacity id"})
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM partner_capacity WHERE capacity_id=?", capacityID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to delete partner capacity"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No partner capacity found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Partner Capacity Deleted Successfully", "capacityDeleted": capacityID})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errUnparseablePhone = errors.New("unparseable phone number")
+
+// normalisePhone converts a phone number as typed into E.164, e.g. "012-345 6789" in Malaysia to "+60123456789".
+// Numbers without a country code are read as national numbers of the given country, which needs reference data
+// in address_data; numbers in international format (+ or 00) are accepted for any country.
+func normalisePhone(value string, country string) (string, error) {
+	// Drop the separators people type between groups of digits
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '/':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+
+	international := false
+	if strings.HasPrefix(digits, "+") {
+		digits, international = digits[1:], true
+	} else if strings.HasPrefix(digits, "00") {
+		digits, international = digits[2:], true
+	}
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", errUnparseablePhone
+	}
+
+	if international {
+		if digits[0] == '0' || len(digits) < 7 || len(digits) > 15 {
+			return "", errUnparseablePhone
+		}
+		return "+" + digits, nil
+	}
+
+	rules := addressRulesFor(country)
+	if rules == nil || rules.CallingCode == "" {
+		return "", errUnparseablePhone
+	}
+
+	// National numbers start with the trunk prefix, or are sometimes typed with the country code but no +
+	national := digits
+	if rules.TrunkPrefix != "" && strings.HasPrefix(digits, rules.TrunkPrefix) {
+		national = strings.TrimPrefix(digits, rules.TrunkPrefix)
+	} else if strings.HasPrefix(digits, rules.CallingCode) && rules.isNationalLength(len(digits)-len(rules.CallingCode)) {
+		national = strings.TrimPrefix(digits, rules.CallingCode)
+	}
+	if national == "" || national[0] == '0' || !rules.isNationalLength(len(national)) {
+		return "", errUnparseablePhone
+	}
+	return "+" + rules.CallingCode + national, nil
+}
+
+func (r *countryAddressRules) isNationalLength(length int) bool {
+	return length >= r.NationalNumberMinLength && length <= r.NationalNumberMaxLength
+}
+
+// backfillPhoneNumbers normalises the phone numbers of orders stored before numbers were normalised.
+// Numbers that cannot be parsed are left without an E.164 form and listed for manual correction.
+func backfillPhoneNumbers() error {
+	rows, err := db.Query("SELECT order_id, consignee_number, consignee_country, pickup_contact_number, pickup_country FROM orders WHERE consignee_number_e164 IS NULL OR pickup_contact_number_e164 IS NULL")
+	if err != nil {
+		return err
+	}
+	type orderPhones struct {
+		orderID          int
+		consigneeNumber  string
+		consigneeCountry string
+		pickupNumber     string
+		pickupCountry    string
+	}
+	var orders []orderPhones
+	for rows.Next() {
+		var current orderPhones
+		if err := rows.Scan(&current.orderID, &current.consigneeNumber, &current.consigneeCountry, &current.pickupNumber, &current.pickupCountry); err != nil {
+			rows.Close()
+			return err
+		}
+		orders = append(orders, current)
+	}
+	rows.Close()
+
+	updated := 0
+	for _, current := range orders {
+		consigneeE164, consigneeErr := normalisePhone(current.consigneeNumber, current.consigneeCountry)
+		pickupE164, pickupErr := normalisePhone(current.pickupNumber, current.pickupCountry)
+		if consigneeErr != nil {
+			fmt.Printf("order %d: cannot parse consignee_number %q\n", current.orderID, current.consigneeNumber)
+		}
+		if pickupErr != nil {
+			fmt.Printf("order %d: cannot parse pickup_contact_number %q\n", current.orderID, current.pickupNumber)
+		}
+
+		// COALESCE keeps a number already normalised when the other one fails to parse
+		if _, err := db.Exec("UPDATE orders SET consignee_number_e164=COALESCE(consignee_number_e164, NULLIF(?, '')), pickup_contact_number_e164=COALESCE(pickup_contact_number_e164, NULLIF(?, '')) WHERE order_id=?", consigneeE164, pickupE164, current.orderID); err != nil {
+			return err
+		}
+		if consigneeErr == nil && pickupErr == nil {
+			updated++
+		}
+	}
+
+	fmt.Printf("Backfill: normalised phone numbers of %d of %d orders\n", updated, len(orders))
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestNormalisePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		country string
+		want    string
+		wantErr bool
+	}{
+		{name: "Malaysian mobile with trunk prefix and separators", value: "012-345 6789", country: "Malaysia", want: "+60123456789"},
+		{name: "Malaysian number without trunk prefix", value: "123456789", country: "MY", want: "+60123456789"},
+		{name: "country code typed without plus", value: "60123456789", country: "Malaysia", want: "+60123456789"},
+		{name: "international format with plus", value: "+60 12-345 6789", country: "Malaysia", want: "+60123456789"},
+		{name: "international format with 00", value: "0060123456789", country: "Malaysia", want: "+60123456789"},
+		{name: "international number for another country", value: "+62 812 3456 7890", country: "Malaysia", want: "+6281234567890"},
+		{name: "Indonesian mobile with trunk prefix", value: "0812-3456-7890", country: "Indonesia", want: "+6281234567890"},
+		{name: "Indonesian number in brackets", value: "(021) 1234 5678", country: "ID", want: "+622112345678"},
+		{name: "country names are case insensitive", value: "0123456789", country: "malaysia", want: "+60123456789"},
+		{name: "empty", value: "", country: "Malaysia", wantErr: true},
+		{name: "letters", value: "012-CALL-NOW", country: "Malaysia", wantErr: true},
+		{name: "too short for the country", value: "012345", country: "Malaysia", wantErr: true},
+		{name: "too long for the country", value: "012345678901", country: "Malaysia", wantErr: true},
+		{name: "trunk prefix only", value: "0", country: "Malaysia", wantErr: true},
+		{name: "national number of a country without reference data", value: "0123456789", country: "Singapore", wantErr: true},
+		{name: "international number starting with zero", value: "+0123456789", country: "Malaysia", wantErr: true},
+		{name: "international number too short", value: "+601234", country: "Malaysia", wantErr: true},
+		{name: "international number too long", value: "+6012345678901234", country: "Malaysia", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalisePhone(tt.value, tt.country)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("normalisePhone(%q, %q) = %q, want an error", tt.value, tt.country, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalisePhone(%q, %q) returned error %v", tt.value, tt.country, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalisePhone(%q, %q) = %q, want %q", tt.value, tt.country, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateCard prices deliveries for one partner role. The consignee address picks a zone, the chargeable weight picks
+// the zone's cheapest band that can carry it, and surcharges are added for oversize parcels and remote postcodes.
+// Weights and lengths are in the configured units (see orderUnits), prices in the card's currency.
+type rateCard struct {
+	RateCardId        int        `json:"rate_card_id"`
+	RoleId            int        `json:"role_id"`
+	RoleName          string     `json:"role_name"`
+	Currency          string     `json:"currency"`
+	OversizeLength    int        `json:"oversize_length"`
+	OversizeWeight    int        `json:"oversize_weight"`
+	OversizeSurcharge float64    `json:"oversize_surcharge"`
+	RemoteSurcharge   float64    `json:"remote_surcharge"`
+	Zones             []rateZone `json:"zones"`
+	Bands             []rateBand `json:"bands"`
+	RemotePostcodes   []string   `json:"remote_postcodes"`
+
+	volumetricDivisor sql.NullInt64
+}
+
+// rateZone matches consignee addresses by country and optionally state, and orders by pickup country if set.
+// Empty origin_country or consignee_state match any.
+type rateZone struct {
+	ZoneName         string `json:"zone_name"`
+	OriginCountry    string `json:"origin_country"`
+	ConsigneeCountry string `json:"consignee_country"`
+	ConsigneeState   string `json:"consignee_state"`
+}
+
+// rateBand is the price of parcels in a zone up to a chargeable weight
+type rateBand struct {
+	ZoneName  string  `json:"zone_name"`
+	MaxWeight float64 `json:"max_weight"`
+	Price     float64 `json:"price"`
+}
+
+type rateCardFromFrontend struct {
+	RoleId            int        `json:"role_id"`
+	Currency          string     `json:"currency"`
+	OversizeLength    int        `json:"oversize_length"`
+	OversizeWeight    int        `json:"oversize_weight"`
+	OversizeSurcharge float64    `json:"oversize_surcharge"`
+	RemoteSurcharge   float64    `json:"remote_surcharge"`
+	Zones             []rateZone `json:"zones"`
+	Bands             []rateBand `json:"bands"`
+	RemotePostcodes   []string   `json:"remote_postcodes"`
+}
+
+// quoteRequest is the part of an order needed to price its delivery
+type quoteRequest struct {
+	OrderLength       int    `json:"order_length"`
+	OrderWidth        int    `json:"order_width"`
+	OrderHeight       int    `json:"order_height"`
+	OrderWeight       int    `json:"order_weight"`
+	PickupCountry     string `json:"pickup_country"`
+	ConsigneeCountry  string `json:"consignee_country"`
+	ConsigneeState    string `json:"consignee_state"`
+	ConsigneeProvince string `json:"consignee_province"`
+	ConsigneePostal   string `json:"consignee_postal"`
+}
+
+// shippingQuote is the price of a delivery under one rate card, with its breakdown
+type shippingQuote struct {
+	RateCardId        int     `json:"rate_card_id"`
+	RoleName          string  `json:"role_name"`
+	ZoneName          string  `json:"zone_name"`
+	VolumetricWeight  float64 `json:"volumetric_weight"`
+	ChargeableWeight  float64 `json:"chargeable_weight"`
+	BasePrice         float64 `json:"base_price"`
+	OversizeSurcharge float64 `json:"oversize_surcharge"`
+	RemoteSurcharge   float64 `json:"remote_surcharge"`
+	Total             float64 `json:"total"`
+	Currency          string  `json:"currency"`
+	WeightUnit        string  `json:"weight_unit"`
+	// Total converted to the base currency at the current exchange rate, unset when there is no rate
+	BaseTotal *float64 `json:"base_total"`
+}
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// loadRateCards reads the rate cards matching where (including the leading "WHERE", or empty) with their zones,
+// bands ordered by weight, and remote postcodes
+func loadRateCards(q queryer, where string, args ...interface{}) ([]rateCard, error) {
+	rows, err := q.Query("SELECT rate_cards.rate_card_id, rate_cards.role_id, roles.role_name, roles.volumetric_divisor, rate_cards.currency, rate_cards.oversize_length, rate_cards.oversize_weight, rate_cards.oversize_surcharge, rate_cards.remote_surcharge FROM rate_cards JOIN roles ON roles.role_id = rate_cards.role_id"+where+" ORDER BY rate_cards.rate_card_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	var cards []rateCard
+	for rows.Next() {
+		card := rateCard{Zones: []rateZone{}, Bands: []rateBand{}, RemotePostcodes: []string{}}
+		if err := rows.Scan(&card.RateCardId, &card.RoleId, &card.RoleName, &card.volumetricDivisor, &card.Currency, &card.OversizeLength, &card.OversizeWeight, &card.OversizeSurcharge, &card.RemoteSurcharge); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	rows.Close()
+
+	for i := range cards {
+		zoneRows, err := q.Query("SELECT zone_name, COALESCE(origin_country, ''), consignee_country, COALESCE(consignee_state, '') FROM rate_card_zones WHERE rate_card_id=? ORDER BY zone_id", cards[i].RateCardId)
+		if err != nil {
+			return nil, err
+		}
+		for zoneRows.Next() {
+			var zone rateZone
+			if err := zoneRows.Scan(&zone.ZoneName, &zone.OriginCountry, &zone.ConsigneeCountry, &zone.ConsigneeState); err != nil {
+				zoneRows.Close()
+				return nil, err
+			}
+			cards[i].Zones = append(cards[i].Zones, zone)
+		}
+		zoneRows.Close()
+
+		bandRows, err := q.Query("SELECT zone_name, max_weight, price FROM rate_card_bands WHERE rate_card_id=? ORDER BY zone_name, max_weight", cards[i].RateCardId)
+		if err != nil {
+			return nil, err
+		}
+		for bandRows.Next() {
+			var band rateBand
+			if err := bandRows.Scan(&band.ZoneName, &band.MaxWeight, &band.Price); err != nil {
+				bandRows.Close()
+				return nil, err
+			}
+			cards[i].Bands = append(cards[i].Bands, band)
+		}
+		bandRows.Close()
+
+		postcodeRows, err := q.Query("SELECT postal_prefix FROM rate_card_remote_postcodes WHERE rate_card_id=? ORDER BY postal_prefix", cards[i].RateCardId)
+		if err != nil {
+			return nil, err
+		}
+		for postcodeRows.Next() {
+			var prefix string
+			if err := postcodeRows.Scan(&prefix); err != nil {
+				postcodeRows.Close()
+				return nil, err
+			}
+			cards[i].RemotePostcodes = append(cards[i].RemotePostcodes, prefix)
+		}
+		postcodeRows.Close()
+	}
+	return cards, nil
+}
+
+// loadCoveringRateCards reads the rate cards of partner roles whose region covers the consignee country
+func loadCoveringRateCards(q queryer, country string) ([]rateCard, error) {
+	return loadRateCards(q, " WHERE roles.is_admin = FALSE AND roles.region_id IN (SELECT region_id FROM region_countries WHERE country=?)", country)
+}
+
+// sameRegion compares states or provinces, accepting the other spellings known for the country
+func sameRegion(country string, a string, b string) bool {
+	a, b = strings.ToLower(collapseSpaces(a)), strings.ToLower(collapseSpaces(b))
+	if rules := addressRulesFor(country); rules != nil {
+		if canonical, found := rules.regionByKey[a]; found {
+			a = strings.ToLower(canonical)
+		}
+		if canonical, found := rules.regionByKey[b]; found {
+			b = strings.ToLower(canonical)
+		}
+	}
+	return a == b
+}
+
+// matchZone returns the most specific zone matching the request: a state match beats a country-wide zone, and an
+// origin match beats a zone for any origin
+func (r rateCard) matchZone(q quoteRequest) *rateZone {
+	var best *rateZone
+	bestScore := -1
+	for i, zone := range r.Zones {
+		if !strings.EqualFold(zone.ConsigneeCountry, q.ConsigneeCountry) {
+			continue
+		}
+		score := 0
+		if zone.ConsigneeState != "" {
+			if !sameRegion(q.ConsigneeCountry, zone.ConsigneeState, q.ConsigneeState) && !sameRegion(q.ConsigneeCountry, zone.ConsigneeState, q.ConsigneeProvince) {
+				continue
+			}
+			score += 2
+		}
+		if zone.OriginCountry != "" {
+			if !strings.EqualFold(zone.OriginCountry, q.PickupCountry) {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &r.Zones[i], score
+		}
+	}
+	return best
+}
+
+// quote prices a delivery, returning false when no zone or weight band of the card covers it
+func (r rateCard) quote(q quoteRequest) (shippingQuote, bool) {
+	zone := r.matchZone(q)
+	if zone == nil {
+		return shippingQuote{}, false
+	}
+
+	divisor := defaultVolumetricDivisor()
+	if r.volumetricDivisor.Valid {
+		divisor = int(r.volumetricDivisor.Int64)
+	}
+	volumetricWeight, chargeableWeight := orderWeights(q.OrderLength, q.OrderWidth, q.OrderHeight, q.OrderWeight, divisor)
+
+	result := shippingQuote{RateCardId: r.RateCardId, RoleName: r.RoleName, ZoneName: zone.ZoneName, VolumetricWeight: volumetricWeight, ChargeableWeight: chargeableWeight, Currency: r.Currency, WeightUnit: orderUnits().Weight}
+
+	// Bands are ordered by weight, so the first that can carry the parcel is the cheapest
+	priced := false
+	for _, band := range r.Bands {
+		if band.ZoneName == zone.ZoneName && chargeableWeight <= band.MaxWeight {
+			result.BasePrice, priced = band.Price, true
+			break
+		}
+	}
+	if !priced {
+		return shippingQuote{}, false
+	}
+
+	longestSide := q.OrderLength
+	if q.OrderWidth > longestSide {
+		longestSide = q.OrderWidth
+	}
+	if q.OrderHeight > longestSide {
+		longestSide = q.OrderHeight
+	}
+	if (r.OversizeLength > 0 && longestSide > r.OversizeLength) || (r.OversizeWeight > 0 && q.OrderWeight > r.OversizeWeight) {
+		result.OversizeSurcharge = r.OversizeSurcharge
+	}
+
+	postal := strings.Join(strings.Fields(q.ConsigneePostal), "")
+	for _, prefix := range r.RemotePostcodes {
+		if postal != "" && strings.HasPrefix(postal, prefix) {
+			result.RemoteSurcharge = r.RemoteSurcharge
+			break
+		}
+	}
+
+	result.Total = math.Round((result.BasePrice+result.OversizeSurcharge+result.RemoteSurcharge)*100) / 100
+	return result, true
+}
+
+// quoteRateCards prices a delivery under each card that covers it, cheapest first. Cards may be in different
+// currencies, so quotes are ranked by their total in the base currency; quotes in a currency without an exchange
+// rate cannot be compared and come last.
+func quoteRateCards(cards []rateCard, q quoteRequest, rates map[string]float64) []shippingQuote {
+	quotes := []shippingQuote{}
+	for _, card := range cards {
+		if result, ok := card.quote(q); ok {
+			if rate, found := rates[result.Currency]; found {
+				baseTotal := math.Round(result.Total*rate*100) / 100
+				result.BaseTotal = &baseTotal
+			}
+			quotes = append(quotes, result)
+		}
+	}
+	sort.SliceStable(quotes, func(i, j int) bool {
+		if (quotes[i].BaseTotal == nil) != (quotes[j].BaseTotal == nil) {
+			return quotes[i].BaseTotal != nil
+		}
+		if quotes[i].BaseTotal != nil {
+			return *quotes[i].BaseTotal < *quotes[j].BaseTotal
+		}
+		if quotes[i].Currency != quotes[j].Currency {
+			return quotes[i].Currency < quotes[j].Currency
+		}
+		return quotes[i].Total < quotes[j].Total
+	})
+	return quotes
+}
+
+// cheapestQuote returns the first of quotes ranked by quoteRateCards, or nil when the cheapest cannot be told
+// because quotes in different currencies have no exchange rate
+func cheapestQuote(quotes []shippingQuote) *shippingQuote {
+	if len(quotes) == 0 {
+		return nil
+	}
+	if quotes[0].BaseTotal != nil {
+		return &quotes[0]
+	}
+	for _, quote := range quotes[1:] {
+		if quote.Currency != quotes[0].Currency {
+			return nil
+		}
+	}
+	return &quotes[0]
+}
+
+// storeOrderShippingCost prices a new or edited order and stores the cost on it. Orders assigned to a partner are
+// priced with that partner's rate card, others with the cheapest card covering the consignee country. Orders no
+// rate card covers, or whose cheapest card cannot be told for lack of exchange rates, are left without a cost.
+func storeOrderShippingCost(q queryExecer, orderID int64) (*shippingQuote, error) {
+	var quote quoteRequest
+	var accountID, orgID sql.NullInt64
+	if err := q.QueryRow("SELECT order_length, order_width, order_height, order_weight, pickup_country, consignee_country, consignee_state, consignee_province, consignee_postal, account_id, org_id FROM orders WHERE order_id=?", orderID).Scan(&quote.OrderLength, &quote.OrderWidth, &quote.OrderHeight, &quote.OrderWeight, &quote.PickupCountry, &quote.ConsigneeCountry, &quote.ConsigneeState, &quote.ConsigneeProvince, &quote.ConsigneePostal, &accountID, &orgID); err != nil {
+		return nil, err
+	}
+
+	var cards []rateCard
+	var err error
+	if accountID.Valid {
+		cards, err = loadRateCards(q, " WHERE roles.role_name = (SELECT account_type FROM accounts WHERE account_id=?)", accountID.Int64)
+	} else if orgID.Valid {
+		cards, err = loadRateCards(q, " WHERE roles.role_name = (SELECT account_type FROM organisations WHERE org_id=?)", orgID.Int64)
+	} else {
+		cards, err = loadCoveringRateCards(q, quote.ConsigneeCountry)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := loadExchangeRates(q)
+	if err != nil {
+		return nil, err
+	}
+	cheapest := cheapestQuote(quoteRateCards(cards, quote, rates))
+	if cheapest == nil {
+		_, err := q.Exec("UPDATE orders SET shipping_cost=NULL, shipping_currency=NULL, rate_card_id=NULL WHERE order_id=?", orderID)
+		return nil, err
+	}
+	if _, err := q.Exec("UPDATE orders SET shipping_cost=?, shipping_currency=?, rate_card_id=? WHERE order_id=?", cheapest.Total, cheapest.Currency, cheapest.RateCardId, orderID); err != nil {
+		return nil, err
+	}
+	return cheapest, nil
+}
+
+func (r *rateCardFromFrontend) validate() string {
+	r.Currency = strings.ToUpper(strings.TrimSpace(r.Currency))
+	if !currencyCodePattern.MatchString(r.Currency) {
+		return "currency must be a three letter ISO 4217 code, e.g. MYR"
+	}
+	if r.OversizeLength < 0 || r.OversizeWeight < 0 || r.OversizeSurcharge < 0 || r.RemoteSurcharge < 0 {
+		return "oversize and remote surcharge settings must not be negative"
+	}
+	if len(r.Zones) == 0 {
+		return "at least one zone is required"
+	}
+
+	zoneHasBand := map[string]bool{}
+	for _, zone := range r.Zones {
+		if zone.ZoneName == "" || zone.ConsigneeCountry == "" {
+			return "zone_name and consignee_country are required for every zone"
+		}
+		if _, found := zoneHasBand[zone.ZoneName]; found {
+			return fmt.Sprintf("zone %s is listed twice", zone.ZoneName)
+		}
+		zoneHasBand[zone.ZoneName] = false
+	}
+	for _, band := range r.Bands {
+		if _, found := zoneHasBand[band.ZoneName]; !found {
+			return fmt.Sprintf("band zone %s is not one of the zones", band.ZoneName)
+		}
+		if band.MaxWeight <= 0 || band.Price < 0 {
+			return "band max_weight must be positive and price must not be negative"
+		}
+		zoneHasBand[band.ZoneName] = true
+	}
+	for zoneName, hasBand := range zoneHasBand {
+		if !hasBand {
+			return fmt.Sprintf("zone %s has no weight bands", zoneName)
+		}
+	}
+	for i, prefix := range r.RemotePostcodes {
+		r.RemotePostcodes[i] = strings.TrimSpace(prefix)
+		if r.RemotePostcodes[i] == "" {
+			return "remote_postcodes must not contain empty prefixes"
+		}
+	}
+	return ""
+}
+
+func getRateCards(c *gin.Context) {
+	cards, err := loadRateCards(db, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve rate cards from DB"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved rate cards from DB", "rateCards": cards})
+}
+
+// putRateCard creates or replaces the rate card of a partner role
+func putRateCard(c *gin.Context) {
+	var reqBody rateCardFromFrontend
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if message := reqBody.validate(); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": message})
+		return
+	}
+
+	var isPartner bool
+	if err := db.QueryRow("SELECT COUNT(*) > 0 FROM roles WHERE role_id=? AND is_admin = FALSE", reqBody.RoleId).Scan(&isPartner); err != nil || !isPartner {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "role_id must be an existing partner role"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save rate card in database"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Unique key on role_id turns a second save for the same role into an update; LAST_INSERT_ID returns the card either way
+	result, err := tx.Exec("INSERT INTO rate_cards (role_id, currency, oversize_length, oversize_weight, oversize_surcharge, remote_surcharge) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE rate_card_id=LAST_INSERT_ID(rate_card_id), currency=VALUES(currency), oversize_length=VALUES(oversize_length), oversize_weight=VALUES(oversize_weight), oversize_surcharge=VALUES(oversize_surcharge), remote_surcharge=VALUES(remote_surcharge)", reqBody.RoleId, reqBody.Currency, reqBody.OversizeLength, reqBody.OversizeWeight, reqBody.OversizeSurcharge, reqBody.RemoteSurcharge)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save rate card in database"})
+		return
+	}
+	rateCardID, _ := result.LastInsertId()
+
+	// Zones, bands and remote postcodes are replaced as a whole
+	for _, table := range []string{"rate_card_zones", "rate_card_bands", "rate_card_remote_postcodes"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE rate_card_id=?", rateCardID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save rate card in database"})
+			return
+		}
+	}
+	for _, zone := range reqBody.Zones {
+		if _, err := tx.Exec("INSERT INTO rate_card_zones (rate_card_id, zone_name, origin_country, consignee_country, consignee_state) VALUES (?, ?, NULLIF(?, ''), ?, NULLIF(?, ''))", rateCardID, zone.ZoneName, zone.OriginCountry, zone.ConsigneeCountry, zone.ConsigneeState); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save rate card zones in database"})
+			return
+		}
+	}
+	for _, band := range reqBody.Bands {
+		if _, err := tx.Exec("INSERT INTO rate_card_bands (rate_card_id, zone_name, max_weight, price) VALUES (?, ?, ?, ?)", rateCardID, band.ZoneName, band.MaxWeight, band.Price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save rate card bands in database"})
+			return
+		}
+	}
+	for _, prefix := range reqBody.RemotePostcodes {
+		if _, err := tx.Exec("INSERT IGNORE INTO rate_card_remote_postcodes (rate_card_id, postal_prefix) VALUES (?, ?)", rateCardID, prefix); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save rate card remote postcodes in database"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save rate card in database"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Rate Card Saved Successfully", "rateCardId": rateCardID})
+}
+
+func deleteRateCard(c *gin.Context) {
+	rateCardID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid rate card id"})
+		return
+	}
+
+	// Zones, bands and remote postcodes are deleted with the card; orders keep the cost they were quoted
+	result, err := db.Exec("DELETE FROM rate_cards WHERE rate_card_id=?", rateCardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to delete rate card"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No rate card found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Rate Card Deleted Successfully", "rateCardDeleted": rateCardID})
+}
+
+// postQuote prices a delivery under every partner rate card covering the consignee country, cheapest first
+func postQuote(c *gin.Context) {
+	var reqBody quoteRequest
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	var errs validationErrors
+	units := orderUnits()
+	errs.requireBetween("order_length", reqBody.OrderLength, units.MaxDimension)
+	errs.requireBetween("order_width", reqBody.OrderWidth, units.MaxDimension)
+	errs.requireBetween("order_height", reqBody.OrderHeight, units.MaxDimension)
+	errs.requireBetween("order_weight", reqBody.OrderWeight, units.MaxWeight)
+	errs.requireText("pickup_country", reqBody.PickupCountry, 255)
+	errs.requireText("consignee_country", reqBody.ConsigneeCountry, 255)
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"status": http.StatusUnprocessableEntity, "message": "Quote request failed validation", "errors": errs})
+		return
+	}
+
+	cards, err := loadCoveringRateCards(db, reqBody.ConsigneeCountry)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve rate cards from DB"})
+		return
+	}
+
+	rates, err := loadExchangeRates(db)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve exchange rates from DB"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully quoted delivery", "quotes": quoteRateCards(cards, reqBody, rates), "baseCurrency": baseCurrency()})
+}
@@ -0,0 +1,166 @@
+package main
+
+import "testing"
+
+// testRateCard covers Malaysia country-wide, Kuala Lumpur for any origin and from Malaysia, and parts of Indonesia
+func testRateCard() rateCard {
+	return rateCard{
+		RateCardId:        1,
+		RoleName:          "partner_malaysia",
+		Currency:          "MYR",
+		OversizeLength:    100,
+		OversizeWeight:    30,
+		OversizeSurcharge: 20,
+		RemoteSurcharge:   5,
+		Zones: []rateZone{
+			{ZoneName: "malaysia", ConsigneeCountry: "Malaysia"},
+			{ZoneName: "kl", ConsigneeCountry: "Malaysia", ConsigneeState: "Kuala Lumpur"},
+			{ZoneName: "kl-domestic", OriginCountry: "Malaysia", ConsigneeCountry: "Malaysia", ConsigneeState: "Kuala Lumpur"},
+			{ZoneName: "jakarta", ConsigneeCountry: "Indonesia", ConsigneeState: "DKI Jakarta"},
+			{ZoneName: "indonesia-from-malaysia", OriginCountry: "Malaysia", ConsigneeCountry: "Indonesia"},
+		},
+		Bands: []rateBand{
+			{ZoneName: "kl", MaxWeight: 5, Price: 7},
+			{ZoneName: "kl-domestic", MaxWeight: 5, Price: 6},
+			{ZoneName: "malaysia", MaxWeight: 1, Price: 8},
+			{ZoneName: "malaysia", MaxWeight: 5, Price: 15},
+			{ZoneName: "malaysia", MaxWeight: 10, Price: 25},
+			{ZoneName: "malaysia", MaxWeight: 50, Price: 60},
+		},
+		RemotePostcodes: []string{"88", "89"},
+	}
+}
+
+func TestRateCardMatchZone(t *testing.T) {
+	tests := []struct {
+		name string
+		q    quoteRequest
+		want string
+	}{
+		{name: "country-wide zone when no state zone matches", q: quoteRequest{PickupCountry: "Malaysia", ConsigneeCountry: "Malaysia", ConsigneeState: "Selangor"}, want: "malaysia"},
+		{name: "state zone beats country-wide zone", q: quoteRequest{PickupCountry: "Singapore", ConsigneeCountry: "Malaysia", ConsigneeState: "Kuala Lumpur"}, want: "kl"},
+		{name: "origin match beats zone for any origin", q: quoteRequest{PickupCountry: "Malaysia", ConsigneeCountry: "Malaysia", ConsigneeState: "Kuala Lumpur"}, want: "kl-domestic"},
+		{name: "country and state are case insensitive", q: quoteRequest{PickupCountry: "malaysia", ConsigneeCountry: "MALAYSIA", ConsigneeState: "kuala  lumpur"}, want: "kl-domestic"},
+		{name: "state zone matches the province field", q: quoteRequest{PickupCountry: "Indonesia", ConsigneeCountry: "Indonesia", ConsigneeProvince: "DKI Jakarta"}, want: "jakarta"},
+		{name: "state match beats origin match", q: quoteRequest{PickupCountry: "Malaysia", ConsigneeCountry: "Indonesia", ConsigneeProvince: "DKI Jakarta"}, want: "jakarta"},
+		{name: "origin zone for other provinces", q: quoteRequest{PickupCountry: "Malaysia", ConsigneeCountry: "Indonesia", ConsigneeProvince: "Bali"}, want: "indonesia-from-malaysia"},
+		{name: "origin zone does not match other origins", q: quoteRequest{PickupCountry: "Singapore", ConsigneeCountry: "Indonesia", ConsigneeProvince: "Bali"}},
+		{name: "country without zones", q: quoteRequest{PickupCountry: "Malaysia", ConsigneeCountry: "Thailand"}},
+	}
+	card := testRateCard()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := card.matchZone(tt.q)
+			got := ""
+			if zone != nil {
+				got = zone.ZoneName
+			}
+			if got != tt.want {
+				t.Errorf("matchZone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateCardQuote(t *testing.T) {
+	t.Setenv("ORDER_UNITS", "")
+	t.Setenv("VOLUMETRIC_DIVISOR", "")
+
+	selangor := func(length int, width int, height int, weight int, postal string) quoteRequest {
+		return quoteRequest{OrderLength: length, OrderWidth: width, OrderHeight: height, OrderWeight: weight, PickupCountry: "Malaysia", ConsigneeCountry: "Malaysia", ConsigneeState: "Selangor", ConsigneePostal: postal}
+	}
+	tests := []struct {
+		name       string
+		q          quoteRequest
+		wantOK     bool
+		zone       string
+		chargeable float64
+		base       float64
+		oversize   float64
+		remote     float64
+		total      float64
+	}{
+		{name: "lightest band", q: selangor(10, 10, 10, 1, "40000"), wantOK: true, zone: "malaysia", chargeable: 1, base: 8, total: 8},
+		{name: "weight on a band limit uses that band", q: selangor(10, 10, 10, 5, "40000"), wantOK: true, zone: "malaysia", chargeable: 5, base: 15, total: 15},
+		{name: "volumetric weight above actual weight picks the band", q: selangor(40, 30, 20, 2, "40000"), wantOK: true, zone: "malaysia", chargeable: 4.8, base: 15, total: 15},
+		{name: "oversize by longest side", q: selangor(10, 120, 10, 1, "40000"), wantOK: true, zone: "malaysia", chargeable: 2.4, base: 15, oversize: 20, total: 35},
+		{name: "oversize by weight", q: selangor(10, 10, 10, 31, "40000"), wantOK: true, zone: "malaysia", chargeable: 31, base: 60, oversize: 20, total: 80},
+		{name: "remote postcode with spaces", q: selangor(10, 10, 10, 1, "88 000"), wantOK: true, zone: "malaysia", chargeable: 1, base: 8, remote: 5, total: 13},
+		{name: "oversize and remote together", q: selangor(101, 10, 10, 1, "89000"), wantOK: true, zone: "malaysia", chargeable: 2.02, base: 15, oversize: 20, remote: 5, total: 40},
+		{name: "most specific zone is priced", q: quoteRequest{OrderLength: 10, OrderWidth: 10, OrderHeight: 10, OrderWeight: 1, PickupCountry: "Malaysia", ConsigneeCountry: "Malaysia", ConsigneeState: "Kuala Lumpur", ConsigneePostal: "50450"}, wantOK: true, zone: "kl-domestic", chargeable: 1, base: 6, total: 6},
+		{name: "heavier than every band", q: selangor(10, 10, 10, 51, "40000")},
+		{name: "zone without bands", q: quoteRequest{OrderLength: 10, OrderWidth: 10, OrderHeight: 10, OrderWeight: 1, PickupCountry: "Malaysia", ConsigneeCountry: "Indonesia", ConsigneeProvince: "Bali"}},
+		{name: "no zone", q: quoteRequest{OrderLength: 10, OrderWidth: 10, OrderHeight: 10, OrderWeight: 1, PickupCountry: "Malaysia", ConsigneeCountry: "Thailand"}},
+	}
+	card := testRateCard()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := card.quote(tt.q)
+			if ok != tt.wantOK {
+				t.Fatalf("quote() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.ZoneName != tt.zone || got.ChargeableWeight != tt.chargeable || got.BasePrice != tt.base || got.OversizeSurcharge != tt.oversize || got.RemoteSurcharge != tt.remote || got.Total != tt.total {
+				t.Errorf("quote() = zone %q, chargeable %v, base %v, oversize %v, remote %v, total %v; want zone %q, chargeable %v, base %v, oversize %v, remote %v, total %v",
+					got.ZoneName, got.ChargeableWeight, got.BasePrice, got.OversizeSurcharge, got.RemoteSurcharge, got.Total,
+					tt.zone, tt.chargeable, tt.base, tt.oversize, tt.remote, tt.total)
+			}
+			if got.Currency != "MYR" || got.WeightUnit != "kg" {
+				t.Errorf("quote() currency %q, weight unit %q, want MYR and kg", got.Currency, got.WeightUnit)
+			}
+		})
+	}
+}
+
+func TestQuoteRateCardsRanksByBaseTotal(t *testing.T) {
+	t.Setenv("ORDER_UNITS", "")
+	t.Setenv("VOLUMETRIC_DIVISOR", "")
+
+	cardIn := func(id int, currency string, price float64) rateCard {
+		return rateCard{
+			RateCardId: id,
+			Currency:   currency,
+			Zones:      []rateZone{{ZoneName: "all", ConsigneeCountry: "Malaysia"}},
+			Bands:      []rateBand{{ZoneName: "all", MaxWeight: 10, Price: price}},
+		}
+	}
+	q := quoteRequest{OrderLength: 10, OrderWidth: 10, OrderHeight: 10, OrderWeight: 1, ConsigneeCountry: "Malaysia"}
+
+	tests := []struct {
+		name         string
+		cards        []rateCard
+		rates        map[string]float64
+		wantOrder    []int
+		wantCheapest int
+	}{
+		{name: "converted totals rank across currencies", cards: []rateCard{cardIn(1, "MYR", 8), cardIn(2, "IDR", 20000)}, rates: map[string]float64{"MYR": 1, "IDR": 0.0003}, wantOrder: []int{2, 1}, wantCheapest: 2},
+		{name: "currencies without a rate come last", cards: []rateCard{cardIn(1, "SGD", 1), cardIn(2, "MYR", 8)}, rates: map[string]float64{"MYR": 1}, wantOrder: []int{2, 1}, wantCheapest: 2},
+		{name: "same currency ranks by total without rates", cards: []rateCard{cardIn(1, "SGD", 9), cardIn(2, "SGD", 4)}, rates: map[string]float64{"MYR": 1}, wantOrder: []int{2, 1}, wantCheapest: 2},
+		{name: "no cheapest across currencies without rates", cards: []rateCard{cardIn(1, "SGD", 9), cardIn(2, "THB", 4)}, rates: map[string]float64{"MYR": 1}, wantOrder: []int{1, 2}},
+		{name: "no cards cover the delivery", cards: []rateCard{}, rates: map[string]float64{"MYR": 1}, wantOrder: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotes := quoteRateCards(tt.cards, q, tt.rates)
+			if len(quotes) != len(tt.wantOrder) {
+				t.Fatalf("quoteRateCards() returned %d quotes, want %d", len(quotes), len(tt.wantOrder))
+			}
+			for i, want := range tt.wantOrder {
+				if quotes[i].RateCardId != want {
+					t.Errorf("quote %d is rate card %d, want %d", i, quotes[i].RateCardId, want)
+				}
+			}
+
+			cheapest := cheapestQuote(quotes)
+			got := 0
+			if cheapest != nil {
+				got = cheapest.RateCardId
+			}
+			if got != tt.wantCheapest {
+				t.Errorf("cheapestQuote() is rate card %d, want %d", got, tt.wantCheapest)
+			}
+		})
+	}
+}
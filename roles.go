@@ -0,0 +1,335 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type role struct {
+	RoleId      int           `json:"role_id"`
+	RoleName    string        `json:"role_name"`
+	IsAdmin     bool          `json:"is_admin"`
+	RegionId    sql.NullInt64 `json:"region_id"`
+	Description string        `json:"description"`
+	// Cubic length units per weight unit, e.g. 5000 cm³/kg; NULL uses VOLUMETRIC_DIVISOR
+	VolumetricDivisor sql.NullInt64 `json:"volumetric_divisor"`
+}
+
+type region struct {
+	RegionId   int      `json:"region_id"`
+	RegionCode string   `json:"region_code"`
+	RegionName string   `json:"region_name"`
+	Timezone   string   `json:"timezone"`
+	Countries  []string `json:"countries"`
+}
+
+type roleFromFrontend struct {
+	RoleName          string `json:"role_name"`
+	IsAdmin           bool   `json:"is_admin"`
+	RegionId          *int   `json:"region_id"`
+	Description       string `json:"description"`
+	VolumetricDivisor *int   `json:"volumetric_divisor"`
+}
+
+type regionFromFrontend struct {
+	RegionCode string   `json:"region_code"`
+	RegionName string   `json:"region_name"`
+	Timezone   string   `json:"timezone"`
+	Countries  []string `json:"countries"`
+}
+
+// isValidAccountType checks the account type against the roles table
+func isValidAccountType(accountType string) bool {
+	var roleID int
+	err := db.QueryRow("SELECT role_id FROM roles WHERE role_name=?", accountType).Scan(&roleID)
+	return err == nil
+}
+
+// isPartnerRole reports whether a role exists, is not an admin role and has a region, i.e. may be given to partner
+// organisations and their members
+func isPartnerRole(roleName string) (bool, error) {
+	var partner bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM roles WHERE role_name=? AND is_admin = FALSE AND region_id IS NOT NULL", roleName).Scan(&partner)
+	return partner, err
+}
+
+// accountCoversCountry reports whether an account may be assigned orders for the given consignee country.
+// Admin roles and roles without a region cannot take orders; partner roles cover the countries of their region.
+func accountCoversCountry(accountID int, country string) (bool, error) {
+	var covered bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM accounts JOIN roles ON roles.role_name = accounts.account_type JOIN region_countries ON region_countries.region_id = roles.region_id WHERE accounts.account_id=? AND roles.is_admin = FALSE AND region_countries.country=?", accountID, country).Scan(&covered)
+	return covered, err
+}
+
+func getRoles(c *gin.Context) {
+	var roles []role
+
+	rows, err := db.Query("SELECT role_id, role_name, is_admin, region_id, description, volumetric_divisor FROM roles ORDER BY role_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve roles from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentRole role
+		if err := rows.Scan(&currentRole.RoleId, &currentRole.RoleName, &currentRole.IsAdmin, &currentRole.RegionId, &currentRole.Description, &currentRole.VolumetricDivisor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save roles from DB"})
+			return
+		}
+		roles = append(roles, currentRole)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved roles from DB", "roles": roles})
+}
+
+func postRole(c *gin.Context) {
+	var reqBody roleFromFrontend
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || reqBody.RoleName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if reqBody.VolumetricDivisor != nil && *reqBody.VolumetricDivisor <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "volumetric_divisor must be a positive number"})
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO roles (role_name, is_admin, region_id, description, volumetric_divisor) VALUES (?, ?, ?, ?, ?)", reqBody.RoleName, reqBody.IsAdmin, reqBody.RegionId, reqBody.Description, reqBody.VolumetricDivisor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create role, role name may be taken or region may not exist"})
+		return
+	}
+	roleID, _ := result.LastInsertId()
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "New Role Successfully Created", "roleId": roleID})
+}
+
+func updateRole(c *gin.Context) {
+	var reqBody roleFromFrontend
+
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid role id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || reqBody.RoleName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if reqBody.VolumetricDivisor != nil && *reqBody.VolumetricDivisor <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "volumetric_divisor must be a positive number"})
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT COUNT(*) > 0 FROM roles WHERE role_id=?", roleID).Scan(&exists); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No role found"})
+		return
+	}
+
+	// Organisations pass their role on to members, so a role in use by one must stay a partner role with a region
+	if reqBody.IsAdmin || reqBody.RegionId == nil {
+		var usedByOrganisation bool
+		if err := db.QueryRow("SELECT COUNT(*) > 0 FROM organisations JOIN roles ON roles.role_name = organisations.account_type WHERE roles.role_id=?", roleID).Scan(&usedByOrganisation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve organisations from DB"})
+			return
+		}
+		if usedByOrganisation {
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "Role is used by organisations and must stay a partner role with a region"})
+			return
+		}
+	}
+
+	// Renaming a role cascades to accounts.account_type through the foreign key
+	if _, err := db.Exec("UPDATE roles SET role_name=?, is_admin=?, region_id=?, description=?, volumetric_divisor=? WHERE role_id=?", reqBody.RoleName, reqBody.IsAdmin, reqBody.RegionId, reqBody.Description, reqBody.VolumetricDivisor, roleID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update role in database"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Role Updated Successfully", "roleUpdated": roleID})
+}
+
+func deleteRole(c *gin.Context) {
+	roleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid role id"})
+		return
+	}
+
+	// Foreign keys on account_type of accounts, organisations and invitations prevent deleting a role still in use
+	result, err := db.Exec("DELETE FROM roles WHERE role_id=?", roleID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "Failed to delete role, it may still be assigned to accounts, organisations or pending invitations"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No role found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Role Deleted Successfully", "roleDeleted": roleID})
+}
+
+func getRegions(c *gin.Context) {
+	var regions []region
+	regionIndex := map[int]int{}
+
+	rows, err := db.Query("SELECT regions.region_id, region_code, region_name, COALESCE(timezone, ''), region_countries.country FROM regions LEFT JOIN region_countries ON region_countries.region_id = regions.region_id ORDER BY regions.region_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve regions from DB"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentRegion region
+		var country sql.NullString
+		if err := rows.Scan(&currentRegion.RegionId, &currentRegion.RegionCode, &currentRegion.RegionName, &currentRegion.Timezone, &country); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save regions from DB"})
+			return
+		}
+
+		// Group country rows under their region
+		index, found := regionIndex[currentRegion.RegionId]
+		if !found {
+			currentRegion.Countries = []string{}
+			regions = append(regions, currentRegion)
+			index = len(regions) - 1
+			regionIndex[currentRegion.RegionId] = index
+		}
+		if country.Valid {
+			regions[index].Countries = append(regions[index].Countries, country.String)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "successfully retrieved regions from DB", "regions": regions})
+}
+
+// saveRegionCountries replaces the country coverage of a region
+func saveRegionCountries(tx *sql.Tx, regionID int64, countries []string) error {
+	if _, err := tx.Exec("DELETE FROM region_countries WHERE region_id=?", regionID); err != nil {
+		return err
+	}
+	for _, country := range countries {
+		if _, err := tx.Exec("INSERT INTO region_countries (region_id, country) VALUES (?, ?)", regionID, country); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func postRegion(c *gin.Context) {
+	var reqBody regionFromFrontend
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || reqBody.RegionCode == "" || reqBody.RegionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if reqBody.Timezone != "" && !isValidTimezone(reqBody.Timezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "timezone must be an IANA timezone, e.g. Asia/Kuala_Lumpur"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create region"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO regions (region_code, region_name, timezone) VALUES (?, ?, NULLIF(?, ''))", reqBody.RegionCode, reqBody.RegionName, reqBody.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create region, region code may be taken"})
+		return
+	}
+	regionID, _ := result.LastInsertId()
+
+	if err := saveRegionCountries(tx, regionID, reqBody.Countries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save region countries"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to create region"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "New Region Successfully Created", "regionId": regionID})
+}
+
+func updateRegion(c *gin.Context) {
+	var reqBody regionFromFrontend
+
+	regionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid region id"})
+		return
+	}
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil || reqBody.RegionCode == "" || reqBody.RegionName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+	if reqBody.Timezone != "" && !isValidTimezone(reqBody.Timezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "timezone must be an IANA timezone, e.g. Asia/Kuala_Lumpur"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update region"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT COUNT(*) > 0 FROM regions WHERE region_id=?", regionID).Scan(&exists); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No region found"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE regions SET region_code=?, region_name=?, timezone=NULLIF(?, '') WHERE region_id=?", reqBody.RegionCode, reqBody.RegionName, reqBody.Timezone, regionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update region in database"})
+		return
+	}
+
+	if err := saveRegionCountries(tx, int64(regionID), reqBody.Countries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to save region countries"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to update region"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Region Updated Successfully", "regionUpdated": regionID})
+}
+
+func deleteRegion(c *gin.Context) {
+	regionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Invalid region id"})
+		return
+	}
+
+	// Foreign key on roles.region_id prevents deleting a region still covered by a role
+	result, err := db.Exec("DELETE FROM regions WHERE region_id=?", regionID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": "Failed to delete region, it may still be used by roles"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "No region found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Region Deleted Successfully", "regionDeleted": regionID})
+}
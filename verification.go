@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const verifyEmailPurpose = "verify_email"
+
+// Verification links expire after 1 day
+const verifyEmailTokenTTL = time.Hour * 24
+
+// rateLimiter allows at most `limit` events per key within `window`
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	events    map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, events: map[string][]time.Time{}}
+}
+
+// Allow records an event against every key, but only when none of them is over its limit, so a request refused for
+// one key does not use up the allowance of the others
+func (r *rateLimiter) Allow(keys ...string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.sweep(now)
+
+	recentByKey := map[string][]time.Time{}
+	allowed := true
+	for _, key := range keys {
+		var recent []time.Time
+		for _, t := range r.events[key] {
+			if now.Sub(t) < r.window {
+				recent = append(recent, t)
+			}
+		}
+		recentByKey[key] = recent
+		if len(recent) >= r.limit {
+			allowed = false
+		}
+	}
+
+	for key, recent := range recentByKey {
+		if allowed {
+			recent = append(recent, now)
+		}
+		if len(recent) == 0 {
+			delete(r.events, key)
+		} else {
+			r.events[key] = recent
+		}
+	}
+	return allowed
+}
+
+// sweep drops keys without events in the current window, at most once per window, so the map does not grow with
+// every email and IP ever seen
+func (r *rateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.window {
+		return
+	}
+	for key, events := range r.events {
+		if len(events) == 0 || now.Sub(events[len(events)-1]) >= r.window {
+			delete(r.events, key)
+		}
+	}
+	r.lastSweep = now
+}
+
+// Resending verification emails is limited per email and per client IP
+var resendVerificationLimiter = newRateLimiter(3, time.Hour)
+
+// newVerificationToken signs a JWT with a purpose claim so it can't be used as an Authorisation cookie
+func newVerificationToken(accountID int, accountEmail string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":        accountEmail,
+		"account_id": accountID,
+		"purpose":    verifyEmailPurpose,
+		"exp":        time.Now().Add(verifyEmailTokenTTL).Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("SECRET")))
+}
+
+func sendVerificationEmail(accountID int, accountEmail string) error {
+	token, err := newVerificationToken(accountID, accountEmail)
+	if err != nil {
+		return err
+	}
+
+	link := frontendURL() + "/verify-email?token=" + token
+	body := fmt.Sprintf("Welcome to GECO!\n\nPlease verify your email address by opening the link below within 24 hours:\n\n%s\n", link)
+	return appMailer.Send(accountEmail, "Verify your GECO account email", body)
+}
+
+func verifyEmail(c *gin.Context) {
+	tokenString := c.Query("token")
+
+	// Decode and validate verification token
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(os.Getenv("SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Verification link is invalid or expired"})
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != verifyEmailPurpose {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Verification link is invalid or expired"})
+		return
+	}
+
+	// Mark account as verified; email must still match in case the account was changed after the link was sent
+	result, err := db.Exec("UPDATE accounts SET email_verified_at=NOW() WHERE account_id=? AND email=? AND email_verified_at IS NULL", claims["account_id"], claims["sub"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to verify email in database"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Email already verified or link no longer valid"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Email Verified Successfully", "emailVerified": claims["sub"]})
+}
+
+func resendVerification(c *gin.Context) {
+	var reqBody email
+
+	// Returns Error HTTP Bad Request 400 if unable to read from request body
+	if c.BindJSON(&reqBody) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to read request body"})
+		return
+	}
+
+	if !resendVerificationLimiter.Allow("email:"+reqBody.Email, "ip:"+c.ClientIP()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"status": http.StatusTooManyRequests, "message": "Too many verification emails requested, please try again later"})
+		return
+	}
+
+	// Same response whether or not the account exists so emails can't be enumerated
+	response := gin.H{"status": http.StatusOK, "message": "If the account exists and is unverified, a verification email has been sent"}
+
+	var accountID int
+	err := db.QueryRow("SELECT account_id FROM accounts WHERE email=? AND email_verified_at IS NULL", reqBody.Email).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, response)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Failed to retrieve account from database"})
+		return
+	}
+
+	// A failure to send is only logged, as a different response would reveal that the account exists
+	if err := sendVerificationEmail(accountID, reqBody.Email); err != nil {
+		fmt.Println(err.Error())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
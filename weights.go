@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// measurementUnits are the units order dimensions and weights are entered and stored in. ORDER_UNITS selects
+// metric (cm and kg, the default) or imperial (in and lb); volumetric divisors must be given in the same units,
+// i.e. cubic centimetres per kg (commonly 5000 or 6000) or cubic inches per lb (commonly 139 or 166).
+type measurementUnits struct {
+	Length         string
+	Weight         string
+	DefaultDivisor int
+	MaxDimension   int
+	MaxWeight      int
+}
+
+var metricUnits = measurementUnits{Length: "cm", Weight: "kg", DefaultDivisor: 5000, MaxDimension: 300, MaxWeight: 500}
+var imperialUnits = measurementUnits{Length: "in", Weight: "lb", DefaultDivisor: 139, MaxDimension: 118, MaxWeight: 1100}
+
+func orderUnits() measurementUnits {
+	if os.Getenv("ORDER_UNITS") == "imperial" {
+		return imperialUnits
+	}
+	return metricUnits
+}
+
+// defaultVolumetricDivisor applies to unassigned orders and partners without their own divisor, configurable with
+// VOLUMETRIC_DIVISOR (default 5000 cm³/kg, or 139 in³/lb for imperial units)
+func defaultVolumetricDivisor() int {
+	divisor, err := strconv.Atoi(os.Getenv("VOLUMETRIC_DIVISOR"))
+	if err != nil || divisor <= 0 {
+		return orderUnits().DefaultDivisor
+	}
+	return divisor
+}
+
+// orderWeights returns the volumetric weight of a parcel and its chargeable weight, the greater of the actual and
+// volumetric weights, both rounded to two decimal places
+func orderWeights(length int, width int, height int, weight int, divisor int) (float64, float64) {
+	volumetric := math.Round(float64(length*width*height)/float64(divisor)*100) / 100
+	return volumetric, math.Max(float64(weight), volumetric)
+}
+
+// partnerVolumetricDivisor returns the divisor of the partner role an order is assigned to, the account's role
+// taking precedence over the organisation's, falling back to the default
+func partnerVolumetricDivisor(q queryer, accountID sql.NullInt64, orgID sql.NullInt64) (int, error) {
+	var divisor sql.NullInt64
+	var err error
+	if accountID.Valid {
+		err = q.QueryRow("SELECT roles.volumetric_divisor FROM accounts JOIN roles ON roles.role_name = accounts.account_type WHERE accounts.account_id=?", accountID.Int64).Scan(&divisor)
+	} else if orgID.Valid {
+		err = q.QueryRow("SELECT roles.volumetric_divisor FROM organisations JOIN roles ON roles.role_name = organisations.account_type WHERE organisations.org_id=?", orgID.Int64).Scan(&divisor)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if !divisor.Valid {
+		return defaultVolumetricDivisor(), nil
+	}
+	return int(divisor.Int64), nil
+}
+
+// queryExecer is satisfied by both *sql.DB and *sql.Tx
+type queryExecer interface {
+	queryer
+	execer
+}
+
+// updateOrderWeights recomputes an order's volumetric and chargeable weights after it is created, assigned or its
+// dimensions change. They are derived data, so the order version is left alone.
+func updateOrderWeights(tx queryExecer, orderID int64) error {
+	var length, width, height, weight int
+	var accountID, orgID sql.NullInt64
+	if err := tx.QueryRow("SELECT order_length, order_width, order_height, order_weight, account_id, org_id FROM orders WHERE order_id=?", orderID).Scan(&length, &width, &height, &weight, &accountID, &orgID); err != nil {
+		return err
+	}
+	divisor, err := partnerVolumetricDivisor(tx, accountID, orgID)
+	if err != nil {
+		return err
+	}
+	volumetric, chargeable := orderWeights(length, width, height, weight, divisor)
+	_, err = tx.Exec("UPDATE orders SET volumetric_weight=?, chargeable_weight=? WHERE order_id=?", volumetric, chargeable, orderID)
+	return err
+}
+
+// backfillOrderWeights recomputes the volumetric and chargeable weights of every order with the configured units
+// and divisors, e.g. for orders created before weights were stored
+func backfillOrderWeights() error {
+	rows, err := db.Query("SELECT order_id FROM orders ORDER BY order_id")
+	if err != nil {
+		return err
+	}
+	var orderIDs []int64
+	for rows.Next() {
+		var orderID int64
+		if err := rows.Scan(&orderID); err != nil {
+			rows.Close()
+			return err
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+
+	for _, orderID := range orderIDs {
+		if err := updateOrderWeights(db, orderID); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Backfill: recomputed weights of %d orders\n", len(orderIDs))
+	return nil
+}